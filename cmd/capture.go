@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/patrikcze/meshtastic_go/pkg/generated"
+	"github.com/patrikcze/meshtastic_go/pkg/meshtastic"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// runCapture implements the "capture" command which lists, filters and decodes a capture file.
+func runCapture(args []string) error {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	dirs := fs.String("dir", "", "comma separated record kinds to show: in, out, debug (default all)")
+	variants := fs.String("variant", "", "comma separated payload variants to show, e.g. packet,queueStatus")
+	port := fs.String("portnum", "", "only show packets on this port, e.g. TEXT_MESSAGE_APP")
+	decode := fs.Bool("decode", false, "print every frame fully decoded as indented JSON")
+	limit := fs.Int("limit", 0, "stop after this many matching records")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: meshtastic_go capture [flags] FILE")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("capture file required")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := meshtastic.NewCaptureReader(f)
+	if err != nil {
+		return err
+	}
+
+	kinds := splitList(*dirs)
+	wantVariants := splitList(*variants)
+	shown := 0
+	for i := 0; ; i++ {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(kinds) > 0 && !slices.Contains(kinds, rec.Kind.String()) {
+			continue
+		}
+
+		msg, err := decodeRecord(rec)
+		if len(wantVariants) > 0 || *port != "" {
+			if msg == nil || !matchVariant(msg, wantVariants) || !matchPort(msg, *port) {
+				continue
+			}
+		}
+
+		fmt.Printf("#%-5d %s %-5s %4dB ", i, rec.Time.Format("2006-01-02 15:04:05.000"), rec.Kind, len(rec.Data))
+		switch {
+		case rec.Kind == meshtastic.CaptureDebug:
+			fmt.Printf("%q\n", rec.Data)
+		case err != nil:
+			fmt.Printf("undecodable: %v\n", err)
+		case *decode:
+			out, _ := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(msg)
+			fmt.Printf("%s\n%s\n", proto.MessageName(msg).Name(), out)
+		default:
+			fmt.Printf("%s{%s}\n", proto.MessageName(msg).Name(), prototext.MarshalOptions{}.Format(msg))
+		}
+
+		shown++
+		if *limit > 0 && shown >= *limit {
+			return nil
+		}
+	}
+}
+
+// decodeRecord decodes a captured frame as FromRadio or ToRadio, depending on its direction.
+// Debug records decode to nil.
+func decodeRecord(rec meshtastic.CaptureRecord) (proto.Message, error) {
+	var msg proto.Message
+	switch rec.Kind {
+	case meshtastic.CaptureIn:
+		msg = &generated.FromRadio{}
+	case meshtastic.CaptureOut:
+		msg = &generated.ToRadio{}
+	default:
+		return nil, nil
+	}
+	if err := proto.Unmarshal(rec.Data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// matchVariant reports whether the payload variant of msg is one of variants. An empty list matches everything.
+func matchVariant(msg proto.Message, variants []string) bool {
+	if len(variants) == 0 {
+		return true
+	}
+	m := msg.ProtoReflect()
+	field := m.WhichOneof(m.Descriptor().Oneofs().ByName("payload_variant"))
+	if field == nil {
+		return false
+	}
+	return slices.ContainsFunc(variants, func(v string) bool {
+		return strings.EqualFold(v, string(field.Name())) || strings.EqualFold(v, field.JSONName())
+	})
+}
+
+// matchPort reports whether msg carries a decoded packet on port. An empty port matches everything.
+func matchPort(msg proto.Message, port string) bool {
+	if port == "" {
+		return true
+	}
+	var packet *generated.MeshPacket
+	switch m := msg.(type) {
+	case *generated.FromRadio:
+		packet = m.GetPacket()
+	case *generated.ToRadio:
+		packet = m.GetPacket()
+	}
+	return packet.GetDecoded() != nil && strings.EqualFold(packet.GetDecoded().GetPortnum().String(), port)
+}
+
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -2,69 +2,283 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/binary"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
-	"meshtastic_go/internal/protocol"
-	"meshtastic_go/internal/transport"
-	"meshtastic_go/pkg/generated"
-	"meshtastic_go/pkg/serial"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/protocol"
+	"github.com/patrikcze/meshtastic_go/pkg/meshtastic"
+	"github.com/patrikcze/meshtastic_go/pkg/serial"
 )
 
+// connectTimeout bounds how long the initial config download may take.
+const connectTimeout = 30 * time.Second
+
 func main() {
-	// Step 1: Detect available USB serial ports for known devices
-	ports := serial.GetPorts()
-	if len(ports) == 0 {
-		log.Fatalf("No suitable USB serial ports found!")
+	if len(os.Args) > 1 && os.Args[1] == "capture" {
+		if err := runCapture(os.Args[2:]); err != nil {
+			log.Fatalf("capture: %v", err)
+		}
+		return
 	}
 
-	// Pick the first detected port for simplicity (can be expanded to handle multiple devices)
-	devPath := ports[0]
-	log.Printf("Using serial port: %s", devPath)
+	portFlag := flag.String("port", "", "serial ports of the radios, comma separated (auto-detected when empty)")
+	hostFlag := flag.String("host", "", "hosts or IPs of network-attached radios, comma separated, port 4403 unless given")
+	allFlag := flag.Bool("all", false, "connect to every detected USB radio instead of the first one")
+	usbRulesFlag := flag.String("usb-rules", "", "JSON file with extra VID/PID or serial number rules for detecting USB radios")
+	listPortsFlag := flag.Bool("list-ports", false, "list the detected USB radios and exit")
+	baudFlag := flag.Int("baud", meshtastic.DefaultSerialBaudRate, "serial port speed, such as 921600 for radios set to it")
+	dataBitsFlag := flag.Int("data-bits", 8, "serial character size")
+	parityFlag := flag.String("parity", "none", "serial parity: none, odd, even, mark or space")
+	stopBitsFlag := flag.String("stop-bits", "1", "serial stop bits: 1, 1.5 or 2")
+	dtrFlag := flag.String("dtr", "default", "DTR line state when opening the serial port: on, off or default")
+	rtsFlag := flag.String("rts", "default", "RTS line state when opening the serial port: on, off or default")
+	noResetFlag := flag.Bool("no-reset", false, "open the serial port with DTR and RTS off, so ESP32 boards do not reboot")
+	readTimeoutFlag := flag.Duration("read-timeout", 0, "reconnect when the serial port stays silent this long, blocking when zero")
+	captureFlag := flag.String("capture", "", "append all traffic with the radio to this capture file")
+	replayFlag := flag.String("replay", "", "play back this capture file instead of talking to a radio")
+	replaySpeedFlag := flag.Float64("replay-speed", 1, "timing of --replay: 1 is the recorded pace, 0 as fast as possible")
+	deviceLogFlag := flag.String("device-log", "", "also write the radio's debug console output to this file")
+	serveFlag := flag.String("serve", "", "share the radio with TCP clients such as apps on this address, e.g. 127.0.0.1:4403, or :4403 for other hosts too")
+	stateFlag := flag.String("state", "", "keep the nodes and config of the radio in this file across restarts")
+	textFlag := flag.String("text", "", "send this text message once connected")
+	toFlag := flag.String("to", "", "destination of --text as node number, !hex ID, short or long name, everyone by default")
+	channelFlag := flag.Uint("channel", 0, "channel index of --text")
+	viaFlag := flag.String("via", "", "with several radios, node number or !hex ID of the radio sending --text (default the first)")
+	flag.Parse()
 
-	// Step 2: Establish a connection using the Connect function
-	streamPort, err := serial.Connect(devPath)
+	var rules []meshtastic.SerialRule
+	if *usbRulesFlag != "" {
+		var err error
+		if rules, err = meshtastic.LoadSerialRules(*usbRulesFlag); err != nil {
+			log.Fatalf("Failed to load USB rules: %v", err)
+		}
+	}
+	serialOpts, err := parseSerialOptions(*baudFlag, *dataBitsFlag, *parityFlag, *stopBitsFlag, *dtrFlag, *rtsFlag, *noResetFlag)
 	if err != nil {
-		log.Fatalf("Failed to open serial connection: %v", err)
+		log.Fatalf("Invalid serial options: %v", err)
+	}
+	serialOpts.ReadTimeout = *readTimeoutFlag
+	if *listPortsFlag {
+		if err := listPorts(rules); err != nil {
+			log.Fatalf("Failed to list ports: %v", err)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Step 1: Set up a client per radio, either over TCP, a USB serial port or a capture replay
+	clients, err := newClients(splitList(*portFlag), splitList(*hostFlag), *allFlag, rules, serialOpts, *replayFlag, *replaySpeedFlag)
+	if err != nil {
+		log.Fatalf("Failed to open radio: %v", err)
+	}
+	multi := len(clients) > 1 || *allFlag
+	if multi && (*captureFlag != "" || *stateFlag != "" || *serveFlag != "") {
+		log.Fatalf("--capture, --state and --serve are only supported with a single radio")
+	}
+
+	// Device debug output is parsed into log records and logged next to our own output
+	sinks := []meshtastic.LogSink{meshtastic.SlogSink(slog.Default().WithGroup("device"))}
+	if *deviceLogFlag != "" {
+		deviceLog, err := os.OpenFile(*deviceLogFlag, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			log.Fatalf("Failed to open device log: %v", err)
+		}
+		defer deviceLog.Close()
+		sinks = append(sinks, meshtastic.WriterSink(deviceLog))
+	}
+	setup := func(client *meshtastic.Client) {
+		client.DebugWriter = meshtastic.NewDebugLogParser(sinks...)
+	}
+	for _, client := range clients {
+		setup(client)
 	}
-	defer streamPort.Close()
 
-	// Step 3: Create the StreamConn object for further protocol handling
-	streamConn := transport.NewRadioStreamConn(streamPort)
+	if multi {
+		runManager(ctx, clients, managerOptions{
+			text:    *textFlag,
+			to:      *toFlag,
+			via:     *viaFlag,
+			channel: uint32(*channelFlag),
+			watch:   *allFlag,
+			rules:   rules,
+			serial:  serialOpts,
+			setup:   setup,
+		})
+		return
+	}
+	client := clients[0]
 
-	dispatcher := transport.NewEventDispatcher()
-	dispatcher.RegisterHandler("MeshPacketReceived", protocol.HandleMeshPacketReceived)
-	// Register new handler for ConfigCompleteId
-	//dispatcher.RegisterHandler("ConfigCompleteId", handleConfigCompletee)
+	if *captureFlag != "" {
+		capture, err := meshtastic.CreateCapture(*captureFlag)
+		if err != nil {
+			log.Fatalf("Failed to open capture file: %v", err)
+		}
+		defer capture.Close()
+		client.Tap = capture
+	}
 
-	// Initialize protocol state
-	state := &transport.State{}
+	client.StateFile = *stateFlag
 
-	// Step 4: Send configuration request
-	// Inside the main function
-	var configID uint32
-	if err := binary.Read(rand.Reader, binary.LittleEndian, &configID); err != nil {
-		log.Fatalf("failed to generate random config ID: %v", err)
+	var server *meshtastic.Server
+	if *serveFlag != "" {
+		server = meshtastic.NewServer(client)
 	}
-	err = protocol.SendConfigRequest(streamConn, configID)
+
+	// Step 2: Register handlers for incoming packets
+	client.Events.RegisterHandler(meshtastic.EventMeshPacketReceived, protocol.HandleMeshPacketReceived)
+
+	// Step 3: Connect and wait for the configuration download
+	connectCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	err = client.Connect(connectCtx)
+	cancel()
 	if err != nil {
-		log.Printf("Failed to send config request: %v", err)
+		_ = client.Close()
+		log.Fatalf("Failed to connect to radio: %v", err)
 	}
+	defer func() {
+		_ = client.Close()
+		client.Wait()
+	}()
+	printState(&client.State)
 
-	// Step 5: Send a test text message
-	err = protocol.SendTextMessage(streamConn, 532783092, 1419948843, "Connected to Device over Serial from GO!", false)
-	if err != nil {
-		log.Fatalf("Failed to send text message: %v", err)
+	if server != nil {
+		ln, err := net.Listen("tcp", *serveFlag)
+		if err != nil {
+			log.Fatalf("Failed to serve: %v", err)
+		}
+		log.Printf("Sharing the radio on %s", ln.Addr())
+		go func() {
+			if err := server.Serve(ctx, ln); err != nil {
+				log.Printf("Serving stopped: %v", err)
+			}
+		}()
+	}
+
+	// Step 4: Send a text message if asked to
+	if *textFlag != "" {
+		to := uint32(meshtastic.BroadcastAddr)
+		if *toFlag != "" {
+			node, ok := client.State.NodeDB().Lookup(*toFlag)
+			if !ok {
+				log.Fatalf("Unknown node: %s", *toFlag)
+			}
+			to = node.Info.GetNum()
+		}
+		packet, err := client.SendText(ctx, to, uint32(*channelFlag), *textFlag)
+		if err != nil {
+			log.Fatalf("Failed to send text message: %v", err)
+		}
+		log.Printf("Text message %d sent to %d", packet.GetId(), packet.GetTo())
+	}
+
+	// Step 5: Keep handling messages from the radio until interrupted or the link is gone for good
+	select {
+	case <-ctx.Done():
+	case <-client.Done():
+		if err := client.Err(); errors.Is(err, io.EOF) {
+			log.Printf("Stream ended")
+		} else if err != nil {
+			log.Printf("Link to radio failed: %v", err)
+		}
 	}
+	log.Printf("Link stats: %+v", client.LinkStats())
+}
 
-	// Step 6: Continuously read incoming messages from the radio device
-	for {
-		var msg generated.FromRadio
-		err := streamConn.Read(&msg)
+// newClients creates a client for every radio selected by the --replay, --host and --port flags.
+// When none is set and --all is not given either, the first detected USB serial radio is used.
+// With --all the USB radios are added by runManager as they are detected.
+func newClients(ports, hosts []string, all bool, rules []meshtastic.SerialRule, serialOpts meshtastic.SerialOptions, replay string, speed float64) ([]*meshtastic.Client, error) {
+	if replay != "" {
+		if len(ports) > 0 || len(hosts) > 0 || all {
+			return nil, fmt.Errorf("--replay cannot be combined with --host, --port or --all")
+		}
+		conn, err := meshtastic.OpenReplay(replay, meshtastic.ReplayOptions{Speed: speed})
 		if err != nil {
-			log.Printf("Error reading from stream: %v", err)
-			continue
+			return nil, err
 		}
-		protocol.HandleMessageProto(&msg, dispatcher, state)
+		log.Printf("Replaying capture: %s", replay)
+		return []*meshtastic.Client{meshtastic.NewClient(meshtastic.NewRadioStreamConn(conn))}, nil
+	}
+	if all && len(ports) > 0 {
+		return nil, fmt.Errorf("--all and --port are mutually exclusive")
+	}
+
+	var clients []*meshtastic.Client
+	for _, host := range hosts {
+		log.Printf("Using TCP host: %s", host)
+		clients = append(clients, meshtastic.New(meshtastic.TCPDialer(host, meshtastic.TCPOptions{})))
+	}
+	for _, port := range ports {
+		log.Printf("Using serial port: %s", port)
+		clients = append(clients, meshtastic.New(meshtastic.SerialDialer(port, serialOpts)))
+	}
+	if len(clients) == 0 && !all {
+		log.Printf("Using first detected serial port")
+		clients = append(clients, meshtastic.New(meshtastic.SerialDialer("", serialOpts, rules...)))
+	}
+	return clients, nil
+}
+
+// parseSerialOptions builds the serial line settings from the flags. --no-reset overrides --dtr and --rts.
+func parseSerialOptions(baud, dataBits int, parity, stopBits, dtr, rts string, noReset bool) (meshtastic.SerialOptions, error) {
+	opts := meshtastic.SerialOptions{BaudRate: baud, DataBits: dataBits}
+	var err error
+	if opts.Parity, err = serial.ParseParity(parity); err != nil {
+		return opts, err
+	}
+	if opts.StopBits, err = serial.ParseStopBits(stopBits); err != nil {
+		return opts, err
+	}
+	if opts.DTR, err = serial.ParseLine(dtr); err != nil {
+		return opts, fmt.Errorf("--dtr: %w", err)
+	}
+	if opts.RTS, err = serial.ParseLine(rts); err != nil {
+		return opts, fmt.Errorf("--rts: %w", err)
+	}
+	if noReset {
+		opts.DTR, opts.RTS = meshtastic.SerialLineOff, meshtastic.SerialLineOff
+	}
+	return opts, nil
+}
+
+// listPorts prints the USB serial ports recognized as a radio.
+func listPorts(rules []meshtastic.SerialRule) error {
+	ports, err := meshtastic.SerialPorts(rules...)
+	if err != nil {
+		return err
+	}
+	if len(ports) == 0 {
+		fmt.Println("No suitable USB serial ports found")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PORT\tVID:PID\tSERIAL\tPRODUCT\tBOARD\tCHIP")
+	for _, p := range ports {
+		fmt.Fprintf(w, "%s\t%s:%s\t%s\t%s\t%s\t%s\n", p.Name, p.VID, p.PID, p.SerialNumber, p.Product, p.Match.Board, p.Match.Chip)
+	}
+	return w.Flush()
+}
+
+// printState logs what the radio reported during the configuration download.
+func printState(state *meshtastic.State) {
+	log.Printf("Node info: %+v", state.NodeInfo())
+	log.Printf("Device metadata: %+v", state.DeviceMetadata())
+	log.Printf("%d nodes known", len(state.Nodes()))
+	protocol.PrintChannelInfoTable(state.Channels())
+	for _, cfg := range state.Configs() {
+		protocol.HandleConfig(cfg)
 	}
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/patrikcze/meshtastic_go/internal/protocol"
+	"github.com/patrikcze/meshtastic_go/pkg/meshtastic"
+)
+
+// managerOptions are the flags used by runManager.
+type managerOptions struct {
+	text, to, via string
+	channel       uint32
+	// watch adds the USB radios recognized by rules, at startup and whenever one is plugged in.
+	watch bool
+	rules []meshtastic.SerialRule
+	// serial are the line settings of the USB radios.
+	serial meshtastic.SerialOptions
+	// setup prepares a client created for a newly detected radio.
+	setup func(*meshtastic.Client)
+}
+
+// runManager connects to several radios at once, logs what any of them receives once, and optionally
+// sends a text message through the radio selected by via. It returns when ctx is done.
+func runManager(ctx context.Context, clients []*meshtastic.Client, opts managerOptions) {
+	manager := meshtastic.NewManager()
+	defer func() {
+		_ = manager.Close()
+		manager.Wait()
+	}()
+	manager.Events.RegisterHandler(meshtastic.EventMeshPacketReceived, func(event meshtastic.Event) {
+		received := event.Data.(meshtastic.RadioPacket)
+		log.Printf("Radio %s:", meshtastic.NodeID(received.Radio))
+		protocol.HandleMeshPacketReceived(meshtastic.Event{Type: event.Type, Data: received.Packet})
+	})
+
+	for _, client := range clients {
+		addRadio(ctx, manager, client)
+	}
+
+	var usb *usbRadios
+	if opts.watch {
+		usb = &usbRadios{manager: manager, opts: opts, radios: make(map[string]uint32)}
+		// The radios present at startup are added right away, so --text can be sent through them.
+		ports, err := meshtastic.SerialPorts(opts.rules...)
+		if err != nil {
+			log.Printf("Failed to list USB radios: %v", err)
+		}
+		for _, port := range ports {
+			usb.add(ctx, port)
+		}
+		go usb.follow(ctx)
+	}
+
+	if len(manager.Radios()) == 0 && !opts.watch {
+		log.Fatalf("Failed to connect to any radio")
+	}
+	log.Printf("%d nodes known across %d radios", len(manager.Nodes()), len(manager.Radios()))
+
+	if opts.text != "" {
+		sendText(ctx, manager, opts)
+	}
+
+	<-ctx.Done()
+}
+
+// addRadio connects client and adds it to manager. It returns the node number of the radio, or zero when
+// that did not work.
+func addRadio(ctx context.Context, manager *meshtastic.Manager, client *meshtastic.Client) uint32 {
+	connectCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	radio, err := manager.Add(connectCtx, client)
+	cancel()
+	if err != nil {
+		// One radio failing to come up should not take the others down.
+		log.Printf("Failed to connect to radio: %v", err)
+		_ = client.Close()
+		return 0
+	}
+	log.Printf("Radio %s connected", meshtastic.NodeID(radio))
+	printState(&client.State)
+	return radio
+}
+
+// usbRadios adds USB radios to a manager as they are plugged in. Each radio gets a client which dials it
+// by its USB serial number, so when the radio comes back on another port the client's reconnect finds it.
+// A radio without a serial number can only be told apart by its port, so its client is removed when it is
+// unplugged and it is added afresh on whatever port it comes back on.
+type usbRadios struct {
+	manager *meshtastic.Manager
+	opts    managerOptions
+	mu      sync.Mutex
+	// radios holds the node number of the radio behind each port key, zero while it is being added.
+	radios map[string]uint32
+}
+
+// add creates and connects a client for the radio on port unless it already has one.
+func (u *usbRadios) add(ctx context.Context, port meshtastic.SerialPort) {
+	key := port.Key()
+	u.mu.Lock()
+	if _, ok := u.radios[key]; ok {
+		u.mu.Unlock()
+		return
+	}
+	u.radios[key] = 0
+	u.mu.Unlock()
+
+	log.Printf("Using serial port: %s (%s)", port.Name, port.Match.Board)
+	client := meshtastic.New(meshtastic.SerialDeviceDialer(key, u.opts.serial, u.opts.rules...))
+	u.opts.setup(client)
+	radio := addRadio(ctx, u.manager, client)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.radios[key]; !ok && radio != 0 {
+		// The port went away while connecting.
+		u.removeRadio(radio)
+		return
+	}
+	if radio == 0 {
+		// Try again when the radio is plugged in the next time.
+		delete(u.radios, key)
+		return
+	}
+	u.radios[key] = radio
+}
+
+// remove drops the client of the radio which was on port unless it can find the radio on another port.
+func (u *usbRadios) remove(port meshtastic.SerialPort) {
+	if port.Stable() {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	radio, ok := u.radios[port.Key()]
+	delete(u.radios, port.Key())
+	if ok && radio != 0 {
+		u.removeRadio(radio)
+	}
+}
+
+// removeRadio takes radio out of the manager.
+func (u *usbRadios) removeRadio(radio uint32) {
+	if err := u.manager.Remove(radio); err != nil {
+		log.Printf("Failed to remove radio %s: %v", meshtastic.NodeID(radio), err)
+		return
+	}
+	log.Printf("Radio %s removed", meshtastic.NodeID(radio))
+}
+
+// follow adds the radios plugged in while running until ctx is done. Radios which are unplugged keep their
+// client, which reconnects once the radio is back, unless they have no USB serial number.
+func (u *usbRadios) follow(ctx context.Context) {
+	watcher := meshtastic.NewSerialWatcher(u.opts.rules...)
+	for change := range watcher.Watch(ctx) {
+		log.Printf("USB radio %s %s on %s", change.Port.Key(), change.Kind, change.Port.Name)
+		switch change.Kind {
+		case meshtastic.SerialAttached:
+			go u.add(ctx, change.Port)
+		case meshtastic.SerialDetached:
+			u.remove(change.Port)
+		}
+	}
+}
+
+// sendText sends the --text message through the radio selected by --via.
+func sendText(ctx context.Context, manager *meshtastic.Manager, opts managerOptions) {
+	// Without --via the first radio sends it.
+	var radio uint32
+	if opts.via != "" {
+		var err error
+		if radio, err = meshtastic.ParseNodeID(opts.via); err != nil {
+			log.Fatalf("Invalid --via: %v", err)
+		}
+	}
+	dest := uint32(meshtastic.BroadcastAddr)
+	if opts.to != "" {
+		node, ok := manager.Lookup(opts.to)
+		if !ok {
+			log.Fatalf("Unknown node: %s", opts.to)
+		}
+		dest = node.Info.GetNum()
+	}
+	packet, err := manager.SendText(ctx, radio, dest, opts.channel, opts.text)
+	if err != nil {
+		log.Fatalf("Failed to send text message: %v", err)
+	}
+	log.Printf("Text message %d sent to %d", packet.GetId(), packet.GetTo())
+}
@@ -1,26 +1,14 @@
-module meshtastic_go
+module github.com/patrikcze/meshtastic_go
 
 go 1.23.1
 
 require (
-	github.com/charmbracelet/log v0.4.0
 	go.bug.st/serial v1.6.2
 	google.golang.org/protobuf v1.34.2
 )
 
 require (
-	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
-	github.com/charmbracelet/lipgloss v0.10.0 // indirect
 	github.com/creack/goselect v0.1.2 // indirect
-	github.com/go-logfmt/logfmt v0.6.0 // indirect
-	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
-	github.com/mattn/go-isatty v0.0.18 // indirect
-	github.com/mattn/go-runewidth v0.0.15 // indirect
-	github.com/muesli/reflow v0.3.0 // indirect
-	github.com/muesli/termenv v0.15.2 // indirect
-	github.com/rivo/uniseg v0.4.7 // indirect
-	golang.org/x/exp v0.0.0-20231006140011-7918f672742d // indirect
-	golang.org/x/lint v0.0.0-20210508222113-6edffad5e616 // indirect
+	github.com/google/go-cmp v0.6.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
-	golang.org/x/tools v0.25.0 // indirect
 )
@@ -0,0 +1,166 @@
+package fakeradio
+
+import (
+	"bytes"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// handleAdmin executes an AdminMessage addressed to the radio. Get requests are answered with the
+// matching response, everything else is applied to the config store and ACKed. With a SessionPasskey
+// configured, requests other than gets are refused unless they carry it.
+func (r *Radio) handleAdmin(l *link, packet *meshtastic.MeshPacket) {
+	req := &meshtastic.AdminMessage{}
+	if err := proto.Unmarshal(packet.GetDecoded().GetPayload(), req); err != nil {
+		r.log.Debug("bad admin message", "err", err)
+		r.sendRouting(l, packet, meshtastic.Routing_BAD_REQUEST)
+		return
+	}
+
+	r.mu.Lock()
+	passkey := r.cfg.SessionPasskey
+	if len(passkey) > 0 && !isGetRequest(req) && !bytes.Equal(req.GetSessionPasskey(), passkey) {
+		r.mu.Unlock()
+		r.sendRouting(l, packet, meshtastic.Routing_NOT_AUTHORIZED)
+		return
+	}
+	resp, reboot := r.applyAdmin(req)
+	r.mu.Unlock()
+	if resp != nil {
+		resp.SessionPasskey = passkey
+	}
+
+	if resp == nil {
+		r.sendRouting(l, packet, meshtastic.Routing_NONE)
+	} else if payload, err := proto.Marshal(resp); err != nil {
+		r.log.Error("encoding admin response", "err", err)
+	} else {
+		r.reply(l, packet, meshtastic.PortNum_ADMIN_APP, payload)
+	}
+	if reboot {
+		r.Reboot()
+	}
+}
+
+// applyAdmin runs req against the config store with r.mu held. It returns the response for get
+// requests and whether the radio has to reboot.
+func (r *Radio) applyAdmin(req *meshtastic.AdminMessage) (*meshtastic.AdminMessage, bool) {
+	switch v := req.GetPayloadVariant().(type) {
+	case *meshtastic.AdminMessage_GetOwnerRequest:
+		return &meshtastic.AdminMessage{PayloadVariant: &meshtastic.AdminMessage_GetOwnerResponse{
+			GetOwnerResponse: proto.Clone(r.cfg.Owner).(*meshtastic.User),
+		}}, false
+	case *meshtastic.AdminMessage_SetOwner:
+		r.cfg.Owner = proto.Clone(v.SetOwner).(*meshtastic.User)
+	case *meshtastic.AdminMessage_GetDeviceMetadataRequest:
+		return &meshtastic.AdminMessage{PayloadVariant: &meshtastic.AdminMessage_GetDeviceMetadataResponse{
+			GetDeviceMetadataResponse: proto.Clone(r.cfg.Metadata).(*meshtastic.DeviceMetadata),
+		}}, false
+	case *meshtastic.AdminMessage_GetChannelRequest:
+		// The request carries the channel index + 1.
+		return &meshtastic.AdminMessage{PayloadVariant: &meshtastic.AdminMessage_GetChannelResponse{
+			GetChannelResponse: r.channel(int32(v.GetChannelRequest) - 1),
+		}}, false
+	case *meshtastic.AdminMessage_SetChannel:
+		r.setChannel(v.SetChannel)
+	case *meshtastic.AdminMessage_GetConfigRequest:
+		return &meshtastic.AdminMessage{PayloadVariant: &meshtastic.AdminMessage_GetConfigResponse{
+			GetConfigResponse: findVariant(r.cfg.Configs, protoreflect.FieldNumber(v.GetConfigRequest)+1),
+		}}, false
+	case *meshtastic.AdminMessage_SetConfig:
+		r.cfg.Configs = replaceVariant(r.cfg.Configs, v.SetConfig)
+	case *meshtastic.AdminMessage_GetModuleConfigRequest:
+		return &meshtastic.AdminMessage{PayloadVariant: &meshtastic.AdminMessage_GetModuleConfigResponse{
+			GetModuleConfigResponse: findVariant(r.cfg.Modules, protoreflect.FieldNumber(v.GetModuleConfigRequest)+1),
+		}}, false
+	case *meshtastic.AdminMessage_SetModuleConfig:
+		r.cfg.Modules = replaceVariant(r.cfg.Modules, v.SetModuleConfig)
+	case *meshtastic.AdminMessage_RebootSeconds:
+		return nil, v.RebootSeconds >= 0
+	default:
+		r.log.Debug("admin message not implemented, ACKing it", "msg", req)
+	}
+	return nil, false
+}
+
+// isGetRequest reports whether req asks for something rather than changing it.
+func isGetRequest(req *meshtastic.AdminMessage) bool {
+	switch req.GetPayloadVariant().(type) {
+	case *meshtastic.AdminMessage_GetChannelRequest,
+		*meshtastic.AdminMessage_GetOwnerRequest,
+		*meshtastic.AdminMessage_GetConfigRequest,
+		*meshtastic.AdminMessage_GetModuleConfigRequest,
+		*meshtastic.AdminMessage_GetCannedMessageModuleMessagesRequest,
+		*meshtastic.AdminMessage_GetDeviceMetadataRequest,
+		*meshtastic.AdminMessage_GetRingtoneRequest,
+		*meshtastic.AdminMessage_GetDeviceConnectionStatusRequest,
+		*meshtastic.AdminMessage_GetNodeRemoteHardwarePinsRequest:
+		return true
+	}
+	return false
+}
+
+// channel returns a copy of the channel at index, or a disabled channel when there is none.
+func (r *Radio) channel(index int32) *meshtastic.Channel {
+	for _, c := range r.cfg.Channels {
+		if c.GetIndex() == index {
+			return proto.Clone(c).(*meshtastic.Channel)
+		}
+	}
+	return &meshtastic.Channel{Index: index, Role: meshtastic.Channel_DISABLED}
+}
+
+// setChannel stores channel in place of the one with the same index.
+func (r *Radio) setChannel(channel *meshtastic.Channel) {
+	channel = proto.Clone(channel).(*meshtastic.Channel)
+	for i, c := range r.cfg.Channels {
+		if c.GetIndex() == channel.GetIndex() {
+			r.cfg.Channels[i] = channel
+			return
+		}
+	}
+	r.cfg.Channels = append(r.cfg.Channels, channel)
+}
+
+// payloadVariant returns the field number of the payload_variant oneof set in msg, or 0.
+// For Config and ModuleConfig it is the admin config type + 1.
+func payloadVariant(msg proto.Message) protoreflect.FieldNumber {
+	m := msg.ProtoReflect()
+	field := m.WhichOneof(m.Descriptor().Oneofs().ByName("payload_variant"))
+	if field == nil {
+		return 0
+	}
+	return field.Number()
+}
+
+// findVariant returns a copy of the config in configs with the given payload_variant field set.
+// When there is none an empty config of that variant is returned.
+func findVariant[T proto.Message](configs []T, number protoreflect.FieldNumber) T {
+	for _, c := range configs {
+		if payloadVariant(c) == number {
+			return proto.Clone(c).(T)
+		}
+	}
+	var zero T
+	m := zero.ProtoReflect().New()
+	if field := m.Descriptor().Fields().ByNumber(number); field != nil {
+		m.Set(field, m.NewField(field))
+	}
+	return m.Interface().(T)
+}
+
+// replaceVariant stores a copy of config in configs in place of the one with the same payload_variant.
+func replaceVariant[T proto.Message](configs []T, config T) []T {
+	config = proto.Clone(config).(T)
+	number := payloadVariant(config)
+	for i, c := range configs {
+		if payloadVariant(c) == number {
+			configs[i] = config
+			return configs
+		}
+	}
+	return append(configs, config)
+}
@@ -0,0 +1,71 @@
+package fakeradio
+
+import (
+	"sync"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+// link is a client connection served by the radio. Outgoing messages are queued and written by
+// their own goroutine, like the firmware's TX buffer, so the radio never blocks on a client that
+// is busy writing itself.
+type link struct {
+	sc    *transport.StreamConn
+	mu    sync.Mutex
+	queue []*meshtastic.FromRadio
+	wake  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// newLink starts the writer of a link on sc.
+func newLink(sc *transport.StreamConn) *link {
+	l := &link{
+		sc:   sc,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go l.writeLoop()
+	return l
+}
+
+// send queues msg for the client.
+func (l *link) send(msg *meshtastic.FromRadio) {
+	l.mu.Lock()
+	l.queue = append(l.queue, msg)
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop writes queued messages until the link is closed or a write fails.
+func (l *link) writeLoop() {
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-l.wake:
+		}
+		l.mu.Lock()
+		msgs := l.queue
+		l.queue = nil
+		l.mu.Unlock()
+		for _, msg := range msgs {
+			if err := l.sc.Write(msg); err != nil {
+				l.close()
+				return
+			}
+		}
+	}
+}
+
+// close stops the writer and closes the connection. It is safe to call more than once.
+func (l *link) close() {
+	l.once.Do(func() {
+		close(l.done)
+		_ = l.sc.Close()
+	})
+}
@@ -0,0 +1,49 @@
+package fakeradio
+
+import (
+	"sync"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+// Mesh connects fake radios so that packets sent through one are received by the others.
+type Mesh struct {
+	mu     sync.Mutex
+	radios []*Radio
+}
+
+// NewMesh creates a mesh of radios.
+func NewMesh(radios ...*Radio) *Mesh {
+	m := &Mesh{}
+	for _, r := range radios {
+		m.Join(r)
+	}
+	return m
+}
+
+// Join adds r to the mesh. A radio can be part of one mesh at a time.
+func (m *Mesh) Join(r *Radio) {
+	r.mu.Lock()
+	r.mesh = m
+	r.mu.Unlock()
+	m.mu.Lock()
+	m.radios = append(m.radios, r)
+	m.mu.Unlock()
+}
+
+// route delivers packet sent through from to the radio it is addressed to, or to every other radio for a broadcast.
+func (m *Mesh) route(from *Radio, packet *meshtastic.MeshPacket) {
+	m.mu.Lock()
+	radios := append([]*Radio(nil), m.radios...)
+	m.mu.Unlock()
+	for _, r := range radios {
+		if r == from {
+			continue
+		}
+		if packet.GetTo() != transport.BroadcastAddr && packet.GetTo() != r.NodeNum() {
+			continue
+		}
+		r.Inject(packet)
+	}
+}
@@ -0,0 +1,347 @@
+// Package fakeradio implements the device side of the Meshtastic stream API in process, so that
+// transport.Client can be exercised without hardware.
+package fakeradio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// DefaultNodeNum is the node number of a radio created without MyInfo.
+	DefaultNodeNum = 0x0fa4e001
+	// DefaultQueueSize is the TX queue size reported in QueueStatus when Config.QueueSize is zero.
+	DefaultQueueSize = 16
+)
+
+// ErrRadioClosed is returned by Serve once the radio has been closed.
+var ErrRadioClosed = errors.New("fake radio closed")
+
+// Config describes what a Radio reports on want_config_id. Nil fields get sensible defaults.
+type Config struct {
+	MyInfo   *meshtastic.MyNodeInfo
+	Metadata *meshtastic.DeviceMetadata
+	// Owner is the user of the radio's own node, reported in its NodeInfo and to get_owner_request.
+	Owner    *meshtastic.User
+	Nodes    []*meshtastic.NodeInfo
+	Channels []*meshtastic.Channel
+	Configs  []*meshtastic.Config
+	Modules  []*meshtastic.ModuleConfig
+	// QueueSize is the number of TX queue slots reported in QueueStatus.
+	QueueSize uint32
+	// NoQueueStatus makes the radio behave like firmware which does not report QueueStatus.
+	NoQueueStatus bool
+	// SessionPasskey is handed out in admin responses. When set, admin requests other than gets must carry it.
+	SessionPasskey []byte
+	// Route decides the routing result of a packet the client sends. It defaults to Routing_NONE, an ACK.
+	Route func(packet *meshtastic.MeshPacket) meshtastic.Routing_Error
+}
+
+// Radio is a fake device. It serves any number of links at once; each link gets its own config
+// download but they share the config store, the injected traffic and the mesh.
+type Radio struct {
+	mu       sync.Mutex
+	cfg      Config
+	links    map[*link]struct{}
+	mesh     *Mesh
+	rebooted bool
+	closed   bool
+	// received records every ToRadio read from the clients, in order.
+	received []*meshtastic.ToRadio
+	log      *slog.Logger
+}
+
+// New creates a Radio which reports cfg. The messages in cfg are cloned.
+func New(cfg Config) *Radio {
+	r := &Radio{
+		links: make(map[*link]struct{}),
+		log:   slog.Default().WithGroup("fakeradio"),
+	}
+	r.cfg = Config{
+		MyInfo:         cloneOr(cfg.MyInfo, &meshtastic.MyNodeInfo{MyNodeNum: DefaultNodeNum}),
+		Metadata:       cloneOr(cfg.Metadata, &meshtastic.DeviceMetadata{FirmwareVersion: "2.5.0.fake"}),
+		Owner:          cloneOr(cfg.Owner, &meshtastic.User{LongName: "Fake Radio", ShortName: "FAKE"}),
+		Nodes:          cloneAll(cfg.Nodes),
+		Channels:       cloneAll(cfg.Channels),
+		Configs:        cloneAll(cfg.Configs),
+		Modules:        cloneAll(cfg.Modules),
+		QueueSize:      cfg.QueueSize,
+		NoQueueStatus:  cfg.NoQueueStatus,
+		SessionPasskey: bytes.Clone(cfg.SessionPasskey),
+		Route:          cfg.Route,
+	}
+	if r.cfg.QueueSize == 0 {
+		r.cfg.QueueSize = DefaultQueueSize
+	}
+	if len(r.cfg.Channels) == 0 {
+		r.cfg.Channels = []*meshtastic.Channel{{
+			Index:    0,
+			Role:     meshtastic.Channel_PRIMARY,
+			Settings: &meshtastic.ChannelSettings{Psk: []byte{1}},
+		}}
+	}
+	return r
+}
+
+// cloneOr returns a copy of msg, or def when msg is nil.
+func cloneOr[T proto.Message](msg T, def T) T {
+	var zero T
+	if any(msg) == any(zero) {
+		return def
+	}
+	return proto.Clone(msg).(T)
+}
+
+// cloneAll returns a deep copy of msgs.
+func cloneAll[T proto.Message](msgs []T) []T {
+	out := make([]T, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, proto.Clone(m).(T))
+	}
+	return out
+}
+
+// NodeNum returns the node number of the radio.
+func (r *Radio) NodeNum() uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg.MyInfo.GetMyNodeNum()
+}
+
+// Pipe serves a new in-memory link and returns its client end.
+func (r *Radio) Pipe() io.ReadWriteCloser {
+	client, device := net.Pipe()
+	go func() {
+		if err := r.Serve(device); err != nil && !errors.Is(err, ErrRadioClosed) {
+			r.log.Debug("link ended", "err", err)
+		}
+	}()
+	return client
+}
+
+// Dialer returns a DialFunc which connects to the radio over a new Pipe on every call,
+// so a client created with transport.NewDialClient can reconnect after DropLinks or Reboot.
+func (r *Radio) Dialer() transport.DialFunc {
+	return func(_ context.Context) (*transport.StreamConn, error) {
+		r.mu.Lock()
+		closed := r.closed
+		r.mu.Unlock()
+		if closed {
+			return nil, ErrRadioClosed
+		}
+		return transport.NewRadioStreamConn(r.Pipe()), nil
+	}
+}
+
+// Serve speaks the device side of the stream API on conn, such as one end of a net.Pipe or a pty,
+// until the link fails, the client disconnects or the radio drops the link. It closes conn on return.
+func (r *Radio) Serve(conn io.ReadWriteCloser) error {
+	sc := transport.NewRadioStreamConn(conn)
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		_ = sc.Close()
+		return ErrRadioClosed
+	}
+	l := newLink(sc)
+	r.links[l] = struct{}{}
+	rebooted := r.rebooted
+	r.rebooted = false
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.links, l)
+		r.mu.Unlock()
+		l.close()
+	}()
+
+	if rebooted {
+		l.send(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_Rebooted{Rebooted: true}})
+	}
+	for {
+		msg := &meshtastic.ToRadio{}
+		if err := sc.Read(msg); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.received = append(r.received, proto.Clone(msg).(*meshtastic.ToRadio))
+		r.mu.Unlock()
+
+		switch variant := msg.GetPayloadVariant().(type) {
+		case *meshtastic.ToRadio_WantConfigId:
+			r.sendConfig(l, variant.WantConfigId)
+		case *meshtastic.ToRadio_Packet:
+			r.handlePacket(l, variant.Packet)
+		case *meshtastic.ToRadio_Disconnect:
+			return nil
+		case *meshtastic.ToRadio_Heartbeat:
+			// The firmware does not answer heartbeats.
+		default:
+			r.log.Debug("ignoring message", "msg", msg)
+		}
+	}
+}
+
+// sendConfig answers want_config_id on l.
+func (r *Radio) sendConfig(l *link, id uint32) {
+	r.mu.Lock()
+	msgs := []*meshtastic.FromRadio{
+		{PayloadVariant: &meshtastic.FromRadio_MyInfo{MyInfo: proto.Clone(r.cfg.MyInfo).(*meshtastic.MyNodeInfo)}},
+		{PayloadVariant: &meshtastic.FromRadio_Metadata{Metadata: proto.Clone(r.cfg.Metadata).(*meshtastic.DeviceMetadata)}},
+		{PayloadVariant: &meshtastic.FromRadio_NodeInfo{NodeInfo: &meshtastic.NodeInfo{
+			Num:  r.cfg.MyInfo.GetMyNodeNum(),
+			User: proto.Clone(r.cfg.Owner).(*meshtastic.User),
+		}}},
+	}
+	for _, n := range r.cfg.Nodes {
+		msgs = append(msgs, &meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_NodeInfo{NodeInfo: proto.Clone(n).(*meshtastic.NodeInfo)}})
+	}
+	for _, c := range r.cfg.Channels {
+		msgs = append(msgs, &meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_Channel{Channel: proto.Clone(c).(*meshtastic.Channel)}})
+	}
+	for _, c := range r.cfg.Configs {
+		msgs = append(msgs, &meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_Config{Config: proto.Clone(c).(*meshtastic.Config)}})
+	}
+	for _, m := range r.cfg.Modules {
+		msgs = append(msgs, &meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_ModuleConfig{ModuleConfig: proto.Clone(m).(*meshtastic.ModuleConfig)}})
+	}
+	r.mu.Unlock()
+	msgs = append(msgs, &meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_ConfigCompleteId{ConfigCompleteId: id}})
+
+	for _, msg := range msgs {
+		l.send(msg)
+	}
+}
+
+// handlePacket reports the packet as queued and then answers it: admin packets for this radio are
+// executed, everything else is routed over the mesh and ACKed.
+func (r *Radio) handlePacket(l *link, packet *meshtastic.MeshPacket) {
+	queued := &meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_QueueStatus{QueueStatus: &meshtastic.QueueStatus{
+		Free:         r.cfg.QueueSize,
+		Maxlen:       r.cfg.QueueSize,
+		MeshPacketId: packet.GetId(),
+	}}}
+	if !r.cfg.NoQueueStatus {
+		l.send(queued)
+	}
+
+	self := r.NodeNum()
+	if packet.GetFrom() == 0 {
+		packet.From = self
+	}
+	if packet.GetTo() == self && packet.GetDecoded().GetPortnum() == meshtastic.PortNum_ADMIN_APP {
+		r.handleAdmin(l, packet)
+		return
+	}
+
+	reason := meshtastic.Routing_NONE
+	if r.cfg.Route != nil {
+		reason = r.cfg.Route(packet)
+	}
+	if reason == meshtastic.Routing_NONE {
+		r.mu.Lock()
+		mesh := r.mesh
+		r.mu.Unlock()
+		if mesh != nil {
+			mesh.route(r, packet)
+		}
+	}
+	r.sendRouting(l, packet, reason)
+}
+
+// sendRouting answers packet with a Routing message carrying reason.
+func (r *Radio) sendRouting(l *link, packet *meshtastic.MeshPacket, reason meshtastic.Routing_Error) {
+	routing, err := proto.Marshal(&meshtastic.Routing{
+		Variant: &meshtastic.Routing_ErrorReason{ErrorReason: reason},
+	})
+	if err != nil {
+		r.log.Error("encoding routing answer", "err", err)
+		return
+	}
+	r.reply(l, packet, meshtastic.PortNum_ROUTING_APP, routing)
+}
+
+// reply sends payload on port to the sender of packet, as an answer to it.
+func (r *Radio) reply(l *link, packet *meshtastic.MeshPacket, port meshtastic.PortNum, payload []byte) {
+	self := r.NodeNum()
+	answer := &meshtastic.MeshPacket{
+		From:    self,
+		To:      self,
+		Channel: packet.GetChannel(),
+		PayloadVariant: &meshtastic.MeshPacket_Decoded{Decoded: &meshtastic.Data{
+			Portnum:   port,
+			Payload:   payload,
+			RequestId: packet.GetId(),
+		}},
+	}
+	l.send(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_Packet{Packet: answer}})
+}
+
+// connected returns the links currently served.
+func (r *Radio) connected() []*link {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	links := make([]*link, 0, len(r.links))
+	for l := range r.links {
+		links = append(links, l)
+	}
+	return links
+}
+
+// Send queues msg for every connected client.
+func (r *Radio) Send(msg *meshtastic.FromRadio) {
+	for _, l := range r.connected() {
+		l.send(msg)
+	}
+}
+
+// Inject delivers packet to the connected clients as if it had been received over the air.
+// A zero To is addressed to this radio.
+func (r *Radio) Inject(packet *meshtastic.MeshPacket) {
+	packet = proto.Clone(packet).(*meshtastic.MeshPacket)
+	if packet.GetTo() == 0 {
+		packet.To = r.NodeNum()
+	}
+	r.Send(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_Packet{Packet: packet}})
+}
+
+// DropLinks closes every connected link, as if the cable was pulled.
+func (r *Radio) DropLinks() {
+	for _, l := range r.connected() {
+		l.close()
+	}
+}
+
+// Reboot drops every link. The next link served starts with a FromRadio rebooted message.
+func (r *Radio) Reboot() {
+	r.mu.Lock()
+	r.rebooted = true
+	r.mu.Unlock()
+	r.DropLinks()
+}
+
+// Received returns a copy of every ToRadio read from the clients so far.
+func (r *Radio) Received() []*meshtastic.ToRadio {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return cloneAll(r.received)
+}
+
+// Close drops every link and makes further Serve calls fail with ErrRadioClosed.
+func (r *Radio) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.DropLinks()
+	return nil
+}
@@ -3,9 +3,10 @@ package protocol
 import (
 	"fmt"
 	"log"
-	"meshtastic_go/pkg/generated"
 	"os"
 	"text/tabwriter"
+
+	"github.com/patrikcze/meshtastic_go/pkg/generated"
 )
 
 // HandleChannel processes and logs channel data in a structured way.
@@ -2,7 +2,8 @@ package protocol
 
 import (
 	"log"
-	"meshtastic_go/pkg/generated"
+
+	"github.com/patrikcze/meshtastic_go/pkg/generated"
 )
 
 // HandleConfig processes and logs configuration data in a structured way
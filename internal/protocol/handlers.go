@@ -3,8 +3,8 @@ package protocol
 import (
 	"log"
 
-	"meshtastic_go/internal/transport"
-	"meshtastic_go/pkg/generated"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	"github.com/patrikcze/meshtastic_go/pkg/generated"
 )
 
 // SendConfigRequest sends a configuration request to the radio.
@@ -15,6 +15,8 @@ import (
 //
 // Returns:
 //   - An error if the request fails, otherwise nil.
+//
+// Deprecated: use Connect of the github.com/patrikcze/meshtastic_go/pkg/meshtastic Client, which also collects the answers.
 func SendConfigRequest(streamConn *transport.StreamConn, configID uint32) error {
 	// Construct the ToRadio message with the WantConfigId payload
 	toRadio := &generated.ToRadio{
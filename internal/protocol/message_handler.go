@@ -2,8 +2,9 @@ package protocol
 
 import (
 	"log"
-	"meshtastic_go/internal/transport"
-	"meshtastic_go/pkg/generated"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	"github.com/patrikcze/meshtastic_go/pkg/generated"
 )
 
 // HandleMessageProto processes incoming protobuf messages and updates state or dispatches events.
@@ -14,6 +15,8 @@ import (
 //   - state: The state object where node information and configs are stored.
 //
 // This function decodes the message and performs actions based on its type.
+//
+// Deprecated: the github.com/patrikcze/meshtastic_go/pkg/meshtastic Client keeps its State and dispatches events itself.
 func HandleMessageProto(msg *generated.FromRadio, dispatcher *transport.EventDispatcher, state *transport.State) {
 	switch payload := msg.GetPayloadVariant().(type) {
 	case *generated.FromRadio_MyInfo:
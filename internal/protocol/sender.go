@@ -2,8 +2,9 @@ package protocol
 
 import (
 	"log"
-	"meshtastic_go/internal/transport"
-	"meshtastic_go/pkg/generated"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	"github.com/patrikcze/meshtastic_go/pkg/generated"
 )
 
 // SendTextMessage sends a text message to a specific receiver over the given stream connection.
@@ -16,6 +17,8 @@ import (
 //
 // Returns:
 //   - An error if the message sending fails, otherwise nil.
+//
+// Deprecated: use SendText of the github.com/patrikcze/meshtastic_go/pkg/meshtastic Client.
 func SendTextMessage(streamConn *transport.StreamConn, to uint32, from uint32, message string, response bool) error {
 	// Construct the inner Decoded message (assuming there's a "Data" or similar type wrapping the Portnum and Payload)
 	decoded := &generated.Data{
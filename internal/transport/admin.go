@@ -0,0 +1,204 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotConnected is returned when packets are sent before Connect, and by requests which need the local
+// node number before the radio reported it.
+var ErrNotConnected = errors.New("radio has not reported its node info yet")
+
+// adminSession holds the passkey the radio hands out in admin responses. Newer firmware only accepts
+// set requests carrying the passkey of a recent response.
+type adminSession struct {
+	mu      sync.Mutex
+	passkey []byte
+}
+
+// SendText sends text to the node to, or to everyone when to is BroadcastAddr, on channel.
+// It returns once the radio accepted the packet; the returned packet carries the assigned ID.
+func (c *Client) SendText(ctx context.Context, to, channel uint32, text string) (*meshtastic.MeshPacket, error) {
+	packet := &meshtastic.MeshPacket{
+		To:      to,
+		Channel: channel,
+		PayloadVariant: &meshtastic.MeshPacket_Decoded{Decoded: &meshtastic.Data{
+			Portnum: meshtastic.PortNum_TEXT_MESSAGE_APP,
+			Payload: []byte(text),
+		}},
+	}
+	if err := c.SendPacket(ctx, packet); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// Admin sends req to the local node and waits for the answer. Get requests return the response
+// message; everything else returns nil once the radio ACKed it.
+func (c *Client) Admin(ctx context.Context, req *meshtastic.AdminMessage) (*meshtastic.AdminMessage, error) {
+	self := c.State.NodeInfo().GetMyNodeNum()
+	if self == 0 {
+		return nil, ErrNotConnected
+	}
+	req = proto.Clone(req).(*meshtastic.AdminMessage)
+	c.admin.mu.Lock()
+	req.SessionPasskey = c.admin.passkey
+	c.admin.mu.Unlock()
+	payload, err := proto.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("encoding admin message: %w", err)
+	}
+
+	wantResponse := expectsResponse(req)
+	answer, err := c.SendAndWait(ctx, &meshtastic.MeshPacket{
+		To:      self,
+		WantAck: true,
+		PayloadVariant: &meshtastic.MeshPacket_Decoded{Decoded: &meshtastic.Data{
+			Portnum:      meshtastic.PortNum_ADMIN_APP,
+			Payload:      payload,
+			WantResponse: wantResponse,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !wantResponse {
+		return nil, nil
+	}
+	resp := &meshtastic.AdminMessage{}
+	if err := proto.Unmarshal(answer.GetDecoded().GetPayload(), resp); err != nil {
+		return nil, fmt.Errorf("decoding admin response: %w", err)
+	}
+	if key := resp.GetSessionPasskey(); len(key) > 0 {
+		c.admin.mu.Lock()
+		c.admin.passkey = key
+		c.admin.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// expectsResponse reports whether the radio answers req with an AdminMessage rather than only an ACK.
+func expectsResponse(req *meshtastic.AdminMessage) bool {
+	switch req.GetPayloadVariant().(type) {
+	case *meshtastic.AdminMessage_GetChannelRequest,
+		*meshtastic.AdminMessage_GetOwnerRequest,
+		*meshtastic.AdminMessage_GetConfigRequest,
+		*meshtastic.AdminMessage_GetModuleConfigRequest,
+		*meshtastic.AdminMessage_GetCannedMessageModuleMessagesRequest,
+		*meshtastic.AdminMessage_GetDeviceMetadataRequest,
+		*meshtastic.AdminMessage_GetRingtoneRequest,
+		*meshtastic.AdminMessage_GetDeviceConnectionStatusRequest,
+		*meshtastic.AdminMessage_GetNodeRemoteHardwarePinsRequest:
+		return true
+	}
+	return false
+}
+
+// GetConfig asks the radio for one section of its config. The answer also replaces the section in the State.
+func (c *Client) GetConfig(ctx context.Context, kind meshtastic.AdminMessage_ConfigType) (*meshtastic.Config, error) {
+	resp, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_GetConfigRequest{GetConfigRequest: kind},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg := resp.GetGetConfigResponse(); cfg != nil {
+		c.State.AddConfig(proto.Clone(cfg).(*meshtastic.Config))
+	}
+	return resp.GetGetConfigResponse(), nil
+}
+
+// SetConfig replaces the config section set in cfg, on the radio and in the State.
+func (c *Client) SetConfig(ctx context.Context, cfg *meshtastic.Config) error {
+	_, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_SetConfig{SetConfig: cfg},
+	})
+	if err == nil {
+		c.State.AddConfig(proto.Clone(cfg).(*meshtastic.Config))
+	}
+	return err
+}
+
+// GetModuleConfig asks the radio for the config of one module. The answer also replaces the module config in the State.
+func (c *Client) GetModuleConfig(ctx context.Context, kind meshtastic.AdminMessage_ModuleConfigType) (*meshtastic.ModuleConfig, error) {
+	resp, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_GetModuleConfigRequest{GetModuleConfigRequest: kind},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg := resp.GetGetModuleConfigResponse(); cfg != nil {
+		c.State.AddModule(proto.Clone(cfg).(*meshtastic.ModuleConfig))
+	}
+	return resp.GetGetModuleConfigResponse(), nil
+}
+
+// SetModuleConfig replaces the module config set in cfg, on the radio and in the State.
+func (c *Client) SetModuleConfig(ctx context.Context, cfg *meshtastic.ModuleConfig) error {
+	_, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_SetModuleConfig{SetModuleConfig: cfg},
+	})
+	if err == nil {
+		c.State.AddModule(proto.Clone(cfg).(*meshtastic.ModuleConfig))
+	}
+	return err
+}
+
+// GetChannel asks the radio for the channel at index. The answer also replaces the channel in the State.
+func (c *Client) GetChannel(ctx context.Context, index uint32) (*meshtastic.Channel, error) {
+	resp, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		// The firmware expects the index + 1, so that channel 0 is not sent as an unset field.
+		PayloadVariant: &meshtastic.AdminMessage_GetChannelRequest{GetChannelRequest: index + 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if channel := resp.GetGetChannelResponse(); channel != nil {
+		c.State.AddChannel(proto.Clone(channel).(*meshtastic.Channel))
+	}
+	return resp.GetGetChannelResponse(), nil
+}
+
+// SetChannel replaces the channel with the same index, on the radio and in the State.
+func (c *Client) SetChannel(ctx context.Context, channel *meshtastic.Channel) error {
+	_, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_SetChannel{SetChannel: channel},
+	})
+	if err == nil {
+		c.State.AddChannel(proto.Clone(channel).(*meshtastic.Channel))
+	}
+	return err
+}
+
+// GetOwner asks the radio for the user of the local node.
+func (c *Client) GetOwner(ctx context.Context) (*meshtastic.User, error) {
+	resp, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_GetOwnerRequest{GetOwnerRequest: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetGetOwnerResponse(), nil
+}
+
+// SetOwner changes the user of the local node.
+func (c *Client) SetOwner(ctx context.Context, owner *meshtastic.User) error {
+	_, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_SetOwner{SetOwner: owner},
+	})
+	return err
+}
+
+// Reboot asks the radio to reboot after seconds. A negative value cancels a pending reboot.
+func (c *Client) Reboot(ctx context.Context, seconds int32) error {
+	_, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_RebootSeconds{RebootSeconds: seconds},
+	})
+	return err
+}
@@ -0,0 +1,129 @@
+package transport_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAdminSessionPasskey(t *testing.T) {
+	passkey := []byte{1, 2, 3, 4}
+	tests := []struct {
+		name    string
+		passkey []byte
+		// getFirst asks for the owner before changing it, which hands out the passkey.
+		getFirst bool
+		wantErr  error
+	}{
+		{name: "set after get", passkey: passkey, getFirst: true},
+		{name: "set without get", passkey: passkey, wantErr: transport.ErrNotAuthorized},
+		{name: "radio without passkey"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{SessionPasskey: tt.passkey})
+			c := newClient(t, radio)
+			connect(t, c)
+			ctx := testContext(t)
+
+			if tt.getFirst {
+				owner, err := c.GetOwner(ctx)
+				if err != nil {
+					t.Fatalf("GetOwner: %v", err)
+				}
+				if owner.GetShortName() == "" {
+					t.Fatalf("GetOwner = %v, want the radio's owner", owner)
+				}
+			}
+			err := c.SetOwner(ctx, &meshtastic.User{LongName: "Renamed", ShortName: "REN"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetOwner = %v, want %v", err, tt.wantErr)
+			}
+			if got := lastAdmin(t, radio).GetSessionPasskey(); tt.getFirst && !bytes.Equal(got, tt.passkey) {
+				t.Errorf("set_owner carried passkey %v, want %v", got, tt.passkey)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			owner, err := c.GetOwner(ctx)
+			if err != nil {
+				t.Fatalf("GetOwner after SetOwner: %v", err)
+			}
+			if owner.GetShortName() != "REN" {
+				t.Errorf("owner = %v, want the new one", owner)
+			}
+		})
+	}
+}
+
+func TestAdminResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *meshtastic.AdminMessage
+		wantResp bool
+	}{
+		{
+			name:     "get request",
+			req:      &meshtastic.AdminMessage{PayloadVariant: &meshtastic.AdminMessage_GetDeviceMetadataRequest{GetDeviceMetadataRequest: true}},
+			wantResp: true,
+		},
+		{
+			name: "set request",
+			req:  &meshtastic.AdminMessage{PayloadVariant: &meshtastic.AdminMessage_SetOwner{SetOwner: &meshtastic.User{ShortName: "REN"}}},
+		},
+		{
+			// Named like a get request, but only ACKed.
+			name: "DFU request",
+			req:  &meshtastic.AdminMessage{PayloadVariant: &meshtastic.AdminMessage_EnterDfuModeRequest{EnterDfuModeRequest: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{})
+			c := newClient(t, radio)
+			connect(t, c)
+			resp, err := c.Admin(testContext(t), tt.req)
+			if err != nil {
+				t.Fatalf("Admin: %v", err)
+			}
+			if (resp != nil) != tt.wantResp {
+				t.Errorf("Admin = %v, want a response: %v", resp, tt.wantResp)
+			}
+			var sent *meshtastic.Data
+			for _, msg := range radio.Received() {
+				if decoded := msg.GetPacket().GetDecoded(); decoded.GetPortnum() == meshtastic.PortNum_ADMIN_APP {
+					sent = decoded
+				}
+			}
+			if sent.GetWantResponse() != tt.wantResp {
+				t.Errorf("want_response = %v, want %v", sent.GetWantResponse(), tt.wantResp)
+			}
+		})
+	}
+}
+
+// lastAdmin returns the last admin message radio received.
+func lastAdmin(t *testing.T, radio *fakeradio.Radio) *meshtastic.AdminMessage {
+	t.Helper()
+	var last *meshtastic.AdminMessage
+	for _, msg := range radio.Received() {
+		decoded := msg.GetPacket().GetDecoded()
+		if decoded.GetPortnum() != meshtastic.PortNum_ADMIN_APP {
+			continue
+		}
+		last = &meshtastic.AdminMessage{}
+		if err := proto.Unmarshal(decoded.GetPayload(), last); err != nil {
+			t.Fatalf("decoding admin message: %v", err)
+		}
+	}
+	if last == nil {
+		t.Fatal("radio received no admin message")
+	}
+	return last
+}
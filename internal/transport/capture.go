@@ -0,0 +1,206 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// captureMagic starts every capture file, followed by the format version.
+var captureMagic = []byte("MTCAP")
+
+// captureVersion is the version of the capture file format.
+const captureVersion = 1
+
+// maxCaptureRecord bounds the size of a single record accepted by CaptureReader.
+const maxCaptureRecord = 1 << 16
+
+// ErrBadCapture is returned when a file is not a capture or is corrupt.
+var ErrBadCapture = errors.New("not a valid capture file")
+
+// CaptureKind tells what a captured record holds.
+type CaptureKind byte
+
+const (
+	// CaptureIn is a frame read from the connection, a FromRadio on the client side.
+	CaptureIn CaptureKind = 1
+	// CaptureOut is a frame written to the connection, a ToRadio on the client side.
+	CaptureOut CaptureKind = 2
+	// CaptureDebug is a run of non-framed bytes read from the connection, usually device log output.
+	CaptureDebug CaptureKind = 3
+)
+
+// String returns a short name for the kind.
+func (k CaptureKind) String() string {
+	switch k {
+	case CaptureIn:
+		return "in"
+	case CaptureOut:
+		return "out"
+	case CaptureDebug:
+		return "debug"
+	default:
+		return fmt.Sprintf("kind(%d)", byte(k))
+	}
+}
+
+// CaptureRecord is a single entry of a capture file.
+type CaptureRecord struct {
+	Kind CaptureKind
+	Time time.Time
+	// Data is the protobuf payload of a frame without the stream header, or the raw debug bytes.
+	Data []byte
+}
+
+// FrameTap observes the traffic of a StreamConn. Frame is called with data the tap must not retain.
+type FrameTap interface {
+	Frame(kind CaptureKind, data []byte)
+}
+
+// CaptureWriter appends records to a capture file. It implements FrameTap and is safe for concurrent use.
+//
+// The file starts with "MTCAP" and a version byte. Each record is a kind byte, the capture time as
+// big-endian unix nanoseconds, the data length as a uvarint and the data.
+type CaptureWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+	// err holds the first write error; once set further records are discarded.
+	err error
+}
+
+// NewCaptureWriter writes the capture header to w and returns a writer for its records.
+func NewCaptureWriter(w io.Writer) (*CaptureWriter, error) {
+	header := append(append([]byte{}, captureMagic...), captureVersion)
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("writing capture header: %w", err)
+	}
+	return &CaptureWriter{w: w}, nil
+}
+
+// CreateCapture opens path for appending records, writing the header if the file is new. A file which
+// is not empty must start with the header of this capture format, otherwise ErrBadCapture is returned.
+// Close the returned writer to close the file.
+func CreateCapture(path string) (*CaptureWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if info.Size() > 0 {
+		if err := readCaptureHeader(f); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &CaptureWriter{w: f}, nil
+	}
+	cw, err := NewCaptureWriter(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return cw, nil
+}
+
+// WriteRecord appends rec to the capture.
+func (c *CaptureWriter) WriteRecord(rec CaptureRecord) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.buf = c.buf[:0]
+	c.buf = append(c.buf, byte(rec.Kind))
+	c.buf = binary.BigEndian.AppendUint64(c.buf, uint64(rec.Time.UnixNano()))
+	c.buf = binary.AppendUvarint(c.buf, uint64(len(rec.Data)))
+	c.buf = append(c.buf, rec.Data...)
+	if _, err := c.w.Write(c.buf); err != nil {
+		c.err = fmt.Errorf("writing capture record: %w", err)
+	}
+	return c.err
+}
+
+// Frame implements FrameTap.
+func (c *CaptureWriter) Frame(kind CaptureKind, data []byte) {
+	_ = c.WriteRecord(CaptureRecord{Kind: kind, Time: time.Now(), Data: data})
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (c *CaptureWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if closer, ok := c.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Err returns the first error the writer ran into.
+func (c *CaptureWriter) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// CaptureReader reads the records of a capture file.
+type CaptureReader struct {
+	r *bufio.Reader
+}
+
+// NewCaptureReader checks the capture header of r and returns a reader for its records.
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	br := bufio.NewReader(r)
+	if err := readCaptureHeader(br); err != nil {
+		return nil, err
+	}
+	return &CaptureReader{r: br}, nil
+}
+
+// readCaptureHeader reads the capture header from r and checks the magic and the version.
+func readCaptureHeader(r io.Reader) error {
+	header := make([]byte, len(captureMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadCapture, err)
+	}
+	if !bytes.Equal(header[:len(captureMagic)], captureMagic) {
+		return ErrBadCapture
+	}
+	if v := header[len(captureMagic)]; v != captureVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrBadCapture, v)
+	}
+	return nil
+}
+
+// Next returns the next record. It returns io.EOF after the last one.
+func (c *CaptureReader) Next() (CaptureRecord, error) {
+	var head [9]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return CaptureRecord{}, fmt.Errorf("%w: truncated record", ErrBadCapture)
+		}
+		return CaptureRecord{}, err
+	}
+	length, err := binary.ReadUvarint(c.r)
+	if err != nil || length > maxCaptureRecord {
+		return CaptureRecord{}, fmt.Errorf("%w: bad record length", ErrBadCapture)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return CaptureRecord{}, fmt.Errorf("%w: truncated record", ErrBadCapture)
+	}
+	return CaptureRecord{
+		Kind: CaptureKind(head[0]),
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(head[1:]))),
+		Data: data,
+	}, nil
+}
@@ -0,0 +1,98 @@
+package transport_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+)
+
+func TestCreateCapture(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing is the content of the file before CreateCapture; nil means no file.
+		existing []byte
+		wantErr  error
+		// wantRecords is the number of records read back after writing one.
+		wantRecords int
+	}{
+		{name: "new file", wantRecords: 1},
+		{name: "empty file", existing: []byte{}, wantRecords: 1},
+		{name: "existing capture", existing: captureWith(t, []byte("first")), wantRecords: 2},
+		{name: "foreign file", existing: []byte("hello, world"), wantErr: transport.ErrBadCapture},
+		{name: "short file", existing: []byte("MT"), wantErr: transport.ErrBadCapture},
+		{name: "other version", existing: []byte("MTCAP\x02"), wantErr: transport.ErrBadCapture},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "capture")
+			if tt.existing != nil {
+				if err := os.WriteFile(path, tt.existing, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cw, err := transport.CreateCapture(path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CreateCapture = %v, want %v", err, tt.wantErr)
+				}
+				// The file is left untouched.
+				if got, _ := os.ReadFile(path); !bytes.Equal(got, tt.existing) {
+					t.Errorf("file changed to %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateCapture: %v", err)
+			}
+			if err := cw.WriteRecord(transport.CaptureRecord{Kind: transport.CaptureIn, Time: time.Now(), Data: []byte("second")}); err != nil {
+				t.Fatalf("WriteRecord: %v", err)
+			}
+			if err := cw.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			cr, err := transport.NewCaptureReader(f)
+			if err != nil {
+				t.Fatalf("NewCaptureReader: %v", err)
+			}
+			var records []transport.CaptureRecord
+			for {
+				rec, err := cr.Next()
+				if err != nil {
+					break
+				}
+				records = append(records, rec)
+			}
+			if len(records) != tt.wantRecords {
+				t.Fatalf("read %d records, want %d", len(records), tt.wantRecords)
+			}
+			if got := string(records[len(records)-1].Data); got != "second" {
+				t.Errorf("last record = %q, want %q", got, "second")
+			}
+		})
+	}
+}
+
+// captureWith returns a capture file holding a single inbound record with data.
+func captureWith(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	cw, err := transport.NewCaptureWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.WriteRecord(transport.CaptureRecord{Kind: transport.CaptureIn, Time: time.Now(), Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
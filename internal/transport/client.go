@@ -6,11 +6,15 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"meshtastic_go/pkg/generated"
-	meshtastic "meshtastic_go/pkg/generated"
+	"github.com/patrikcze/meshtastic_go/pkg/generated"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -18,6 +22,10 @@ import (
 var (
 	// ErrTimeout is returned when the connection to the radio times out.
 	ErrTimeout = errors.New("timeout connecting to radio")
+	// ErrClosed is returned when the client is used after Close.
+	ErrClosed = errors.New("client closed")
+	// ErrNoResponse is the link failure reported when the radio does not answer a liveness probe within LivenessTimeout.
+	ErrNoResponse = errors.New("radio stopped responding")
 )
 
 // HandlerFunc is a function that handles a protobuf message.
@@ -25,11 +33,70 @@ type HandlerFunc func(message proto.Message)
 
 // Client is a client for interacting with a Meshtastic radio.
 type Client struct {
+	scMu     sync.RWMutex
 	sc       *StreamConn
+	dial     DialFunc
 	handlers *HandlerRegistry
 	log      *slog.Logger
 
+	cfgOnce     sync.Once
+	cfgComplete chan struct{}
+
+	// ctx is cancelled by Close and bounds the read loop and reconnect attempts.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	startOnce sync.Once
+	loadOnce  sync.Once
+	started   bool
+	done      chan struct{}
+	// closing is set by the first Close, and closed is closed once it finished; closeErr is its result.
+	closing  atomic.Bool
+	closed   chan struct{}
+	closeErr error
+	errMu    sync.Mutex
+	err      error
+	// stale is set by the heartbeat when it tears down an unresponsive link.
+	stale    atomic.Bool
+	packets  packetIDs
+	queue    *sendQueue
+	pipeline pipeline
+	subs     subscriptions
+	admin    adminSession
+	// stateSave serializes the saves of StateFile and remembers State.Changes of the last one.
+	stateSave struct {
+		sync.Mutex
+		saved uint64
+	}
+
 	State State
+	// Events receives link events such as EventDisconnected and EventReconnected, and EventMeshPacketReceived
+	// for every packet passed on to the handlers.
+	Events *EventDispatcher
+	// Backoff controls the delay between reconnect attempts of a client created with NewDialClient.
+	Backoff Backoff
+	// HeartbeatInterval is how often a ToRadio heartbeat is sent to keep the link awake. Zero disables it.
+	HeartbeatInterval time.Duration
+	// LivenessTimeout is how long the radio may take to answer a liveness probe before the link is considered dead.
+	// The firmware does not answer heartbeats, so when nothing was received for a HeartbeatInterval the client
+	// asks the radio for its device metadata instead. Zero disables the probe, which needs HeartbeatInterval.
+	LivenessTimeout time.Duration
+	// WakeAfterIdle is applied to every link the client uses, see StreamConn.WakeAfterIdle.
+	WakeAfterIdle time.Duration
+	// DebugWriter, when set, is applied to every link the client uses, see StreamConn.DebugWriter.
+	// Use a DebugLogParser to turn the device debug console into log records.
+	DebugWriter io.Writer
+	// Tap, when set, is applied to every link the client uses, see StreamConn.Tap.
+	Tap FrameTap
+	// LinkStatsInterval is how often a snapshot of the link health counters is logged. Zero disables it.
+	LinkStatsInterval time.Duration
+	// QueueStatusTimeout is how long the send queue waits for the radio to report the result of a packet.
+	QueueStatusTimeout time.Duration
+	// StateFile, when set, is where the State is kept across restarts. Connect restores it before dialing,
+	// so the cached nodes and config are readable while the radio sends them again, and the client saves
+	// it every StateSaveInterval when it changed, and on Close.
+	StateFile string
+	// StateSaveInterval is how often the State is checked for changes to be saved to StateFile.
+	StateSaveInterval time.Duration
 }
 
 // State represents the state of the client.
@@ -39,10 +106,21 @@ type State struct {
 	configID       uint32
 	nodeInfo       *meshtastic.MyNodeInfo
 	deviceMetadata *meshtastic.DeviceMetadata
-	nodes          []*meshtastic.NodeInfo
+	nodes          NodeDB
 	channels       []*meshtastic.Channel
 	configs        []*meshtastic.Config
 	modules        []*meshtastic.ModuleConfig
+	// local and localModules hold the sections of configs and modules as one message each, kept in
+	// step with them; nil until the first section arrives.
+	local        *meshtastic.LocalConfig
+	localModules *meshtastic.LocalModuleConfig
+	// seen holds the channel indexes and config variants received since the config download started,
+	// so that cached entries the radio no longer has can be dropped when it completes.
+	seen map[string]bool
+	// changes counts the modifications, so a saver can tell whether a new snapshot is needed.
+	changes atomic.Uint64
+	// notify receives the change events, see SetNotify.
+	notify func(Event)
 }
 
 // Complete returns true if the configuration is complete.
@@ -73,17 +151,20 @@ func (s *State) DeviceMetadata() *meshtastic.DeviceMetadata {
 	return proto.Clone(s.deviceMetadata).(*meshtastic.DeviceMetadata)
 }
 
-// Nodes returns the list of nodes.
+// Nodes returns the list of nodes ordered by node number.
 func (s *State) Nodes() []*meshtastic.NodeInfo {
-	s.RLock()
-	defer s.RUnlock()
 	var nodeInfos []*meshtastic.NodeInfo
-	for _, n := range s.nodes {
-		nodeInfos = append(nodeInfos, proto.Clone(n).(*meshtastic.NodeInfo))
+	for _, n := range s.nodes.All() {
+		nodeInfos = append(nodeInfos, n.Info)
 	}
 	return nodeInfos
 }
 
+// NodeDB returns the node database, which is kept up to date from received packets.
+func (s *State) NodeDB() *NodeDB {
+	return &s.nodes
+}
+
 // Channels returns the list of channels.
 func (s *State) Channels() []*meshtastic.Channel {
 	s.RLock()
@@ -95,7 +176,7 @@ func (s *State) Channels() []*meshtastic.Channel {
 	return channels
 }
 
-// Configs returns the list of configurations.
+// Configs returns the list of configurations, one per section. LocalConfig returns them as a single message.
 func (s *State) Configs() []*meshtastic.Config {
 	s.RLock()
 	defer s.RUnlock()
@@ -106,7 +187,7 @@ func (s *State) Configs() []*meshtastic.Config {
 	return configs
 }
 
-// Modules returns the list of modules.
+// Modules returns the list of module configurations, one per module. LocalModuleConfig returns them as a single message.
 func (s *State) Modules() []*meshtastic.ModuleConfig {
 	s.RLock()
 	defer s.RUnlock()
@@ -117,11 +198,23 @@ func (s *State) Modules() []*meshtastic.ModuleConfig {
 	return configs
 }
 
-// SetComplete sets the configuration complete flag.
+// SetComplete sets the configuration complete flag. Completing a config download which reported channels
+// or configs drops those restored from a snapshot which the radio did not report again.
 func (s *State) SetComplete(complete bool) {
 	s.Lock()
-	defer s.Unlock()
 	s.complete = complete
+	var events []Event
+	if complete && s.seen != nil {
+		events = s.reconcile()
+	}
+	s.changes.Add(1)
+	s.Unlock()
+	s.emit(events)
+}
+
+// Changes returns a counter which increases whenever the state is modified.
+func (s *State) Changes() uint64 {
+	return s.changes.Load() + s.nodes.changes.Load()
 }
 
 // SetConfigID sets the configuration ID.
@@ -131,56 +224,227 @@ func (s *State) SetConfigID(configID uint32) {
 	s.configID = configID
 }
 
-// SetNodeInfo sets the node information.
+// SetNodeInfo sets the node information and reports a change with EventMyInfoChanged. When it names another
+// radio than the one the State held, as happens after restoring the snapshot of another radio, the nodes of
+// the old radio are dropped.
 func (s *State) SetNodeInfo(nodeInfo *meshtastic.MyNodeInfo) {
 	s.Lock()
-	defer s.Unlock()
+	before := s.nodeInfo
 	s.nodeInfo = nodeInfo
+	s.changes.Add(1)
+	s.Unlock()
+	if num := before.GetMyNodeNum(); num != 0 && num != nodeInfo.GetMyNodeNum() {
+		s.nodes.restore(nil)
+	}
+	s.emit(changeEvent(EventMyInfoChanged, before, nodeInfo, MyInfoChange{
+		Before: before,
+		After:  proto.Clone(nodeInfo).(*meshtastic.MyNodeInfo),
+	}))
 }
 
 // SetDeviceMetadata sets the device metadata.
 func (s *State) SetDeviceMetadata(deviceMetadata *meshtastic.DeviceMetadata) {
 	s.Lock()
-	defer s.Unlock()
+	before := s.deviceMetadata
 	s.deviceMetadata = deviceMetadata
+	s.changes.Add(1)
+	s.Unlock()
+	s.emit(changeEvent(EventMetadataChanged, before, deviceMetadata, MetadataChange{
+		Before: before,
+		After:  proto.Clone(deviceMetadata).(*meshtastic.DeviceMetadata),
+	}))
 }
 
-// AddNode adds a node to the list of nodes.
+// AddNode adds a node to the node database, replacing a node with the same number.
 func (s *State) AddNode(node *meshtastic.NodeInfo) {
-	s.Lock()
-	defer s.Unlock()
-	s.nodes = append(s.nodes, node)
+	s.nodes.Put(node)
 }
 
-// AddChannel adds a channel to the list of channels.
+// AddChannel adds a channel to the list of channels, replacing a channel with the same index.
 func (s *State) AddChannel(channel *meshtastic.Channel) {
 	s.Lock()
-	defer s.Unlock()
-	s.channels = append(s.channels, channel)
+	var before *meshtastic.Channel
+	s.channels, before = upsert(s.channels, channel, channelKey)
+	s.markSeen(channelKey(channel))
+	s.Unlock()
+	s.emit(changeEvent(EventChannelChanged, before, channel, ChannelChange{
+		Before: before,
+		After:  proto.Clone(channel).(*meshtastic.Channel),
+	}))
 }
 
-// AddConfig adds a configuration to the list of configurations.
+// AddConfig adds a configuration to the list of configurations, replacing a configuration of the same section.
 func (s *State) AddConfig(config *meshtastic.Config) {
+	s.Lock()
+	var before *meshtastic.Config
+	s.configs, before = upsert(s.configs, config, variantKey[*meshtastic.Config])
+	if s.local == nil {
+		s.local = &meshtastic.LocalConfig{}
+	}
+	setSection(s.local, config)
+	s.markSeen(variantKey(config))
+	s.Unlock()
+	s.emit(changeEvent(EventConfigChanged, before, config, ConfigChange{
+		Before: before,
+		After:  proto.Clone(config).(*meshtastic.Config),
+	}))
+}
+
+// reset prepares the state for the config download of a new link. What is already known stays
+// readable until the download completes and replaces it.
+func (s *State) reset() {
 	s.Lock()
 	defer s.Unlock()
-	s.configs = append(s.configs, config)
+	s.complete = false
+	s.configID = 0
+	s.seen = nil
 }
 
-// AddModule adds a module to the list of modules.
+// AddModule adds a module to the list of modules, replacing the config of the same module.
 func (s *State) AddModule(module *meshtastic.ModuleConfig) {
 	s.Lock()
-	defer s.Unlock()
-	s.modules = append(s.modules, module)
+	var before *meshtastic.ModuleConfig
+	s.modules, before = upsert(s.modules, module, variantKey[*meshtastic.ModuleConfig])
+	if s.localModules == nil {
+		s.localModules = &meshtastic.LocalModuleConfig{}
+	}
+	setSection(s.localModules, module)
+	s.markSeen(variantKey(module))
+	s.Unlock()
+	s.emit(changeEvent(EventModuleConfigChanged, before, module, ModuleConfigChange{
+		Before: before,
+		After:  proto.Clone(module).(*meshtastic.ModuleConfig),
+	}))
+}
+
+// markSeen records key as received during the current config download, with s locked.
+func (s *State) markSeen(key string) {
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	s.seen[key] = true
+	s.changes.Add(1)
+}
+
+// reconcile drops the channels and configs not received during the config download, with s locked.
+// It returns the change events for the dropped entries.
+func (s *State) reconcile() []Event {
+	var events []Event
+	var channels []*meshtastic.Channel
+	s.channels, channels = keepSeen(s.channels, channelKey, s.seen)
+	for _, channel := range channels {
+		events = append(events, Event{Type: EventChannelChanged, Data: ChannelChange{Before: channel}})
+	}
+	var configs []*meshtastic.Config
+	s.configs, configs = keepSeen(s.configs, variantKey[*meshtastic.Config], s.seen)
+	for _, config := range configs {
+		events = append(events, Event{Type: EventConfigChanged, Data: ConfigChange{Before: config}})
+	}
+	var modules []*meshtastic.ModuleConfig
+	s.modules, modules = keepSeen(s.modules, variantKey[*meshtastic.ModuleConfig], s.seen)
+	for _, module := range modules {
+		events = append(events, Event{Type: EventModuleConfigChanged, Data: ModuleConfigChange{Before: module}})
+	}
+	if len(configs) > 0 || len(modules) > 0 {
+		s.rebuildLocal()
+	}
+	s.seen = nil
+	return events
+}
+
+// channelKey identifies a channel by its index.
+func channelKey(channel *meshtastic.Channel) string {
+	return "channel/" + strconv.Itoa(int(channel.GetIndex()))
+}
+
+// variantKey identifies a config by the section set in its payload variant.
+func variantKey[T proto.Message](msg T) string {
+	return string(proto.MessageName(msg)) + "/" + variantName(msg)
+}
+
+// upsert replaces the entry of list with the same key as item, or appends item.
+// It returns the updated list and the replaced entry.
+func upsert[T any](list []T, item T, key func(T) string) ([]T, T) {
+	k := key(item)
+	for i, existing := range list {
+		if key(existing) == k {
+			list[i] = item
+			return list, existing
+		}
+	}
+	var none T
+	return append(list, item), none
+}
+
+// keepSeen returns the entries of list whose key is in seen, and the dropped ones.
+func keepSeen[T any](list []T, key func(T) string, seen map[string]bool) (kept, dropped []T) {
+	kept = list[:0]
+	for _, item := range list {
+		if seen[key(item)] {
+			kept = append(kept, item)
+		} else {
+			dropped = append(dropped, item)
+		}
+	}
+	return kept, dropped
 }
 
 // NewClient creates a new client.
 func NewClient(sc *StreamConn, errorOnNoHandler bool) *Client {
-	return &Client{
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
 		// TODO: allow consumer to specify logger
-		log:      slog.Default().WithGroup("client"),
-		sc:       sc,
-		handlers: NewHandlerRegistry(errorOnNoHandler),
+		log:         slog.Default().WithGroup("client"),
+		sc:          sc,
+		handlers:    NewHandlerRegistry(errorOnNoHandler),
+		cfgComplete: make(chan struct{}),
+		queue:       newSendQueue(),
+		Events:      NewEventDispatcher(),
+		Backoff:     DefaultBackoff,
+
+		QueueStatusTimeout: DefaultQueueStatusTimeout,
+		StateSaveInterval:  DefaultStateSaveInterval,
 	}
+	c.State.SetNotify(func(event Event) { c.Events.Dispatch(event) })
+	return c
+}
+
+// NewDialClient creates a new client which opens its link with dial.
+// When the link dies the client closes it, re-dials with exponential backoff and re-requests the config.
+func NewDialClient(dial DialFunc, errorOnNoHandler bool) *Client {
+	c := NewClient(nil, errorOnNoHandler)
+	c.dial = dial
+	return c
+}
+
+// setConn makes sc the current link to the radio.
+func (c *Client) setConn(sc *StreamConn) {
+	c.configureConn(sc)
+	c.scMu.Lock()
+	c.sc = sc
+	c.scMu.Unlock()
+}
+
+// configureConn applies the link settings of the client to sc.
+func (c *Client) configureConn(sc *StreamConn) {
+	sc.WakeAfterIdle = c.WakeAfterIdle
+	if c.DebugWriter != nil {
+		sc.DebugWriter = c.DebugWriter
+	}
+	if c.Tap != nil {
+		sc.Tap = c.Tap
+	}
+}
+
+// conn returns the current link to the radio.
+func (c *Client) conn() *StreamConn {
+	c.scMu.RLock()
+	defer c.scMu.RUnlock()
+	return c.sc
 }
 
 // sendGetConfig sends a GetConfig message to the radio.
@@ -191,116 +455,304 @@ func (c *Client) sendGetConfig() error {
 		return fmt.Errorf("failed to generate random config ID: %w", err)
 	}
 
-	c.State.configID = r
+	c.State.SetConfigID(r)
 	msg := &generated.ToRadio{
 		PayloadVariant: &generated.ToRadio_WantConfigId{
 			WantConfigId: r,
 		},
 	}
 	c.log.Debug("sending want config", "id", r)
-	if err := c.sc.Write(msg); err != nil {
+	if err := c.write(c.ctx, msg); err != nil {
 		return fmt.Errorf("writing want config command: %w", err)
 	}
 	c.log.Debug("sent want config")
 	return nil
 }
 
-// Handle registers a handler for a protobuf message.
-func (c *Client) Handle(kind proto.Message, handler MessageHandler) {
-	c.handlers.RegisterHandler(kind, handler)
+// Handle registers a handler for a protobuf message. An optional ExecPolicy controls how calls are scheduled.
+func (c *Client) Handle(kind proto.Message, handler MessageHandler, policy ...ExecPolicy) {
+	c.handlers.RegisterHandler(kind, handler, policy...)
+}
+
+// DroppedMessages returns the number of handler calls and subscription events discarded because a queue was full.
+func (c *Client) DroppedMessages() uint64 {
+	return c.handlers.Dropped() + c.subs.dropped.Load()
 }
 
 // SendToRadio sends a message to the radio.
+// Packets go through the send queue, see SendPacket; everything else is written straight away.
+// Before Connect it returns ErrNotConnected.
 func (c *Client) SendToRadio(msg *meshtastic.ToRadio) error {
-	return c.sc.Write(msg)
+	if packet := msg.GetPacket(); packet != nil {
+		return c.SendPacket(c.ctx, packet)
+	}
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	if !c.isStarted() {
+		return ErrNotConnected
+	}
+	return c.write(c.ctx, msg)
 }
 
-// Connect connects to the radio.
+// isStarted reports whether Connect started the read and send loops.
+func (c *Client) isStarted() bool {
+	c.scMu.RLock()
+	defer c.scMu.RUnlock()
+	return c.started
+}
+
+// Connect connects to the radio and waits until the initial config has been received or ctx is done.
+// The read loop keeps running after Connect returns, until Close is called or the link fails for good.
 func (c *Client) Connect(ctx context.Context) error {
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	if c.StateFile != "" {
+		c.loadOnce.Do(c.loadState)
+	}
+	if c.conn() == nil {
+		if c.dial == nil {
+			return errors.New("client has neither a connection nor a dialer")
+		}
+		sc, err := c.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("dialing radio: %w", err)
+		}
+		c.setConn(sc)
+	} else {
+		c.configureConn(c.conn())
+	}
 	if err := c.sendGetConfig(); err != nil {
 		return fmt.Errorf("requesting config: %w", err)
 	}
-	cfgComplete := make(chan struct{})
-	go func() {
-		for {
-			msg := &meshtastic.FromRadio{}
-			err := c.sc.Read(msg)
-			if err != nil {
-				c.log.Error("error reading from radio", "err", err)
-				continue
-			}
-			c.log.Debug("received message from radio", "msg", msg)
-			var variant proto.Message
-			switch msg.GetPayloadVariant().(type) {
-			// These pbufs all get sent upon initial connection to the node
-			case *meshtastic.FromRadio_MyInfo:
-				c.State.SetNodeInfo(msg.GetMyInfo())
-				variant = c.State.nodeInfo
-			case *meshtastic.FromRadio_Metadata:
-				c.State.SetDeviceMetadata(msg.GetMetadata())
-				variant = c.State.deviceMetadata
-			case *meshtastic.FromRadio_NodeInfo:
-				node := msg.GetNodeInfo()
-				c.State.AddNode(node)
-				variant = node
-			case *meshtastic.FromRadio_Channel:
-				channel := msg.GetChannel()
-				c.State.AddChannel(channel)
-				variant = channel
-			case *meshtastic.FromRadio_Config:
-				cfg := msg.GetConfig()
-				c.State.AddConfig(cfg)
-				variant = cfg
-			case *meshtastic.FromRadio_ModuleConfig:
-				cfg := msg.GetModuleConfig()
-				c.State.AddModule(cfg)
-				variant = cfg
-			case *meshtastic.FromRadio_ConfigCompleteId:
-				// logged here because it's not an actual proto.Message that we can call handlers on
-				c.log.Debug("config complete")
-				if !c.State.Complete() {
-					close(cfgComplete)
-				}
-				c.State.SetComplete(true)
-				continue
-				// below are packets not part of initial connection
-
-			case *meshtastic.FromRadio_LogRecord:
-				variant = msg.GetLogRecord()
-			case *meshtastic.FromRadio_MqttClientProxyMessage:
-				variant = msg.GetMqttClientProxyMessage()
-			case *meshtastic.FromRadio_QueueStatus:
-				variant = msg.GetQueueStatus()
-			case *meshtastic.FromRadio_Rebooted:
-				// true if radio just rebooted
-				// logged here because it's not an actual proto.Message that we can call handlers on
-				c.log.Debug("rebooted", "rebooted", msg.GetRebooted())
-
-				continue
-			case *meshtastic.FromRadio_XmodemPacket:
-				variant = msg.GetXmodemPacket()
-			case *meshtastic.FromRadio_Packet:
-				variant = msg.GetPacket()
-			default:
-				c.log.Warn("unhandled protobuf from radio")
-			}
-
-			if !c.State.Complete() {
-				continue
-			}
-			err = c.handlers.HandleMessage(variant)
-			if err != nil {
-				c.log.Error("error handling message", "err", err)
-			}
+	c.startOnce.Do(func() {
+		c.scMu.Lock()
+		c.started = true
+		c.scMu.Unlock()
+		go c.readLoop()
+		go c.sendLoop()
+		if c.HeartbeatInterval > 0 {
+			go c.heartbeatLoop()
 		}
-	}()
+		if c.LinkStatsInterval > 0 {
+			go c.linkStatsLoop()
+		}
+		if c.StateFile != "" && c.StateSaveInterval > 0 {
+			go c.stateSaveLoop()
+		}
+	})
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ErrTimeout
-		case <-cfgComplete:
+		case <-c.done:
+			if err := c.Err(); err != nil {
+				return err
+			}
+			return ErrClosed
+		case <-c.cfgComplete:
 			return nil
 		}
 	}
 }
+
+// Run connects to the radio and blocks until ctx is cancelled, Close is called or the link fails for good.
+// On return the client has been closed. Run returns nil after a requested shutdown and the terminal
+// link error otherwise.
+func (c *Client) Run(ctx context.Context) error {
+	if err := c.Connect(ctx); err != nil {
+		if ctx.Err() != nil {
+			err = nil
+		}
+		if cerr := c.Close(); err == nil && cerr != nil {
+			c.log.Debug("closing client", "err", cerr)
+		}
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-c.done:
+	}
+	if err := c.Close(); err != nil {
+		c.log.Debug("closing client", "err", err)
+	}
+	c.Wait()
+	return c.Err()
+}
+
+// Close stops the read loop, tells the radio we are disconnecting, closes the link and saves the State
+// to StateFile. It is safe to call Close more than once and from several goroutines.
+//
+// Close does not wait for the read loop to stop or for the handlers still running, so it may also be
+// called from a handler, such as to stop once a certain message arrived. Call Wait for that.
+func (c *Client) Close() error {
+	if !c.closing.CompareAndSwap(false, true) {
+		<-c.closed
+		return c.closeErr
+	}
+	c.cancel()
+	if sc := c.conn(); sc != nil {
+		disconnect := &meshtastic.ToRadio{
+			PayloadVariant: &meshtastic.ToRadio_Disconnect{Disconnect: true},
+		}
+		if werr := c.write(context.Background(), disconnect); werr != nil {
+			c.log.Debug("sending disconnect", "err", werr)
+		}
+		c.closeErr = sc.Close()
+	}
+	if c.StateFile != "" {
+		c.saveState()
+	}
+	close(c.closed)
+	return c.closeErr
+}
+
+// Wait blocks until the read loop has stopped and the handlers of the client and of its Events have
+// returned. After Close that is as soon as the slowest handler is done. Wait must not be called from a
+// handler, which would wait for itself.
+func (c *Client) Wait() {
+	if c.isStarted() {
+		<-c.done
+	}
+	c.handlers.Wait()
+	c.Events.Wait()
+}
+
+// Done returns a channel which is closed once the read loop has stopped, after Close or when the link
+// failed for good. Err tells which.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that terminated the read loop, if any.
+func (c *Client) Err() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+// readLoop reads messages from the radio until the client is closed or the link fails for good.
+func (c *Client) readLoop() {
+	defer close(c.done)
+	for {
+		data, err := c.conn().ReadBytes()
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			if c.stale.Swap(false) {
+				err = ErrNoResponse
+			}
+			c.log.Error("error reading from radio", "err", err)
+			if c.dial == nil {
+				c.log.Info("link lost", "link", c.conn().Stats())
+				c.fail(err)
+				c.Events.Dispatch(Event{Type: EventDisconnected, Data: err})
+				return
+			}
+			if err := c.reconnect(err); err != nil {
+				return
+			}
+			continue
+		}
+		msg := &meshtastic.FromRadio{}
+		if err := proto.Unmarshal(data, msg); err != nil {
+			c.conn().countDecodeError()
+			c.log.Error("error decoding message from radio", "err", err)
+			continue
+		}
+		if err := c.receive(msg); err != nil {
+			c.log.Error("error processing message from radio", "err", err)
+		}
+	}
+}
+
+// fail records the error which terminated the read loop.
+func (c *Client) fail(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// handleFromRadio updates the client state from msg and passes it on to the registered handlers and subscribers.
+func (c *Client) handleFromRadio(ctx context.Context, msg *meshtastic.FromRadio) {
+	c.log.Debug("received message from radio", "msg", msg)
+	var variant proto.Message
+	switch msg.GetPayloadVariant().(type) {
+	// These pbufs all get sent upon initial connection to the node
+	case *meshtastic.FromRadio_MyInfo:
+		variant = msg.GetMyInfo()
+		c.State.SetNodeInfo(msg.GetMyInfo())
+	case *meshtastic.FromRadio_Metadata:
+		variant = msg.GetMetadata()
+		c.State.SetDeviceMetadata(msg.GetMetadata())
+	case *meshtastic.FromRadio_NodeInfo:
+		node := msg.GetNodeInfo()
+		c.State.AddNode(node)
+		variant = node
+	case *meshtastic.FromRadio_Channel:
+		channel := msg.GetChannel()
+		c.State.AddChannel(channel)
+		variant = channel
+	case *meshtastic.FromRadio_Config:
+		cfg := msg.GetConfig()
+		c.State.AddConfig(cfg)
+		variant = cfg
+	case *meshtastic.FromRadio_ModuleConfig:
+		cfg := msg.GetModuleConfig()
+		c.State.AddModule(cfg)
+		variant = cfg
+	case *meshtastic.FromRadio_ConfigCompleteId:
+		// A download asked for before the last want_config, e.g. on a link which has since been replaced.
+		if id := msg.GetConfigCompleteID(); id != c.State.ConfigID() {
+			c.log.Debug("ignoring config complete of another request", "id", id, "want", c.State.ConfigID())
+			return
+		}
+		// logged here because it's not an actual proto.Message that we can call handlers on
+		c.log.Debug("config complete")
+		c.State.SetComplete(true)
+		c.cfgOnce.Do(func() { close(c.cfgComplete) })
+		return
+		// below are packets not part of initial connection
+
+	case *meshtastic.FromRadio_LogRecord:
+		variant = msg.GetLogRecord()
+	case *meshtastic.FromRadio_MqttClientProxyMessage:
+		variant = msg.GetMqttClientProxyMessage()
+	case *meshtastic.FromRadio_QueueStatus:
+		variant = msg.GetQueueStatus()
+		c.queue.status(msg.GetQueueStatus())
+	case *meshtastic.FromRadio_Rebooted:
+		// true if radio just rebooted
+		// logged here because it's not an actual proto.Message that we can call handlers on
+		c.log.Debug("rebooted", "rebooted", msg.GetRebooted())
+
+		return
+	case *meshtastic.FromRadio_XmodemPacket:
+		variant = msg.GetXmodemPacket()
+	case *meshtastic.FromRadio_Packet:
+		variant = msg.GetPacket()
+		c.packets.resolve(msg.GetPacket())
+		if node := c.State.NodeDB().Update(msg.GetPacket()); node != nil && c.State.Complete() {
+			c.Events.Dispatch(Event{Type: EventNodeUpdated, Data: node})
+		}
+	default:
+		c.log.Warn("unhandled protobuf from radio")
+		return
+	}
+
+	if !c.State.Complete() {
+		return
+	}
+	if err := c.handlers.HandleMessage(variant); err != nil {
+		c.log.Error("error handling message", "err", err)
+	}
+	if packet := msg.GetPacket(); packet != nil {
+		c.subs.publish(ctx, packet)
+		c.Events.Dispatch(Event{Type: EventMeshPacketReceived, Data: packet, Annotations: AnnotationsFrom(ctx)})
+	}
+}
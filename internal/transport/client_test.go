@@ -0,0 +1,267 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestClientClose(t *testing.T) {
+	tests := []struct {
+		name string
+		// policy schedules the handler calling Close; nil closes from the test goroutine.
+		policy *transport.ExecPolicy
+	}{
+		{name: "from caller"},
+		{name: "from concurrent handler", policy: &transport.ExecPolicy{}},
+		{name: "from sequential handler", policy: &transport.ExecPolicy{Mode: transport.ExecSequential}},
+		{name: "from per-sender handler", policy: &transport.ExecPolicy{Mode: transport.ExecPerSender, Workers: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{})
+			c := newClient(t, radio)
+			closed := make(chan error, 2)
+			// A slow handler still runs after Close returned, until Wait drained it.
+			started, release := make(chan struct{}), make(chan struct{})
+			releaseOnce := sync.OnceFunc(func() { close(release) })
+			// Registered after newClient, so a failing test lets the handler go before waiting for it.
+			t.Cleanup(releaseOnce)
+			var finished atomic.Bool
+			c.Events.RegisterHandler(transport.EventMeshPacketReceived, func(event transport.Event) {
+				if event.Data.(*meshtastic.MeshPacket).GetId() != 2 {
+					return
+				}
+				close(started)
+				<-release
+				finished.Store(true)
+			})
+			if tt.policy != nil {
+				c.Events.RegisterHandler(transport.EventMeshPacketReceived, func(event transport.Event) {
+					if event.Data.(*meshtastic.MeshPacket).GetId() == 1 {
+						closed <- c.Close()
+					}
+				}, *tt.policy)
+			}
+			connect(t, c)
+
+			radio.Inject(&meshtastic.MeshPacket{From: 7, Id: 2})
+			waitFor(t, started, "the slow handler to start")
+			if tt.policy != nil {
+				radio.Inject(&meshtastic.MeshPacket{From: 7, Id: 1})
+			} else {
+				closed <- c.Close()
+			}
+			waitFor(t, closed, "Close to return")
+			waitFor(t, c.Done(), "the read loop to stop")
+			if finished.Load() {
+				t.Fatal("slow handler finished before it was released")
+			}
+			waited := make(chan struct{})
+			go func() {
+				c.Wait()
+				close(waited)
+			}()
+			releaseOnce()
+			waitFor(t, waited, "Wait to return")
+			if !finished.Load() {
+				t.Error("Wait returned before the slow handler")
+			}
+			// A second Close returns at once, from any goroutine.
+			if err := c.Close(); err != nil {
+				t.Errorf("second Close: %v", err)
+			}
+			if err := c.Connect(context.Background()); !errors.Is(err, transport.ErrClosed) {
+				t.Errorf("Connect after Close = %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestClientRun(t *testing.T) {
+	radio := newRadio(t, fakeradio.Config{})
+	c := newClient(t, radio)
+	ctx, cancel := context.WithCancel(testContext(t))
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+	eventually(t, "the config download", c.State.Complete)
+	cancel()
+	if err := waitFor(t, done, "Run to return"); err != nil {
+		t.Errorf("Run after cancel = %v, want nil", err)
+	}
+	waitFor(t, c.Done(), "the read loop to stop")
+}
+
+func TestClientConnect(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          fakeradio.Config
+		wantNodes    int
+		wantChannels int
+		wantConfigs  int
+	}{
+		{name: "defaults", wantNodes: 1, wantChannels: 1},
+		{
+			name: "nodes channels and configs",
+			cfg: fakeradio.Config{
+				Nodes: []*meshtastic.NodeInfo{{Num: 7}, {Num: 8}},
+				Channels: []*meshtastic.Channel{
+					{Index: 0, Role: meshtastic.Channel_PRIMARY},
+					{Index: 1, Role: meshtastic.Channel_SECONDARY},
+				},
+				Configs: []*meshtastic.Config{{PayloadVariant: &meshtastic.Config_Lora{Lora: &meshtastic.Config_LoRaConfig{}}}},
+			},
+			wantNodes:    3,
+			wantChannels: 2,
+			wantConfigs:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, tt.cfg)
+			c := newClient(t, radio)
+			connect(t, c)
+
+			if !c.State.Complete() {
+				t.Fatal("State not complete after Connect")
+			}
+			nonces := wantConfigIDs(radio)
+			if len(nonces) != 1 {
+				t.Fatalf("radio received %d want_config_id, want 1", len(nonces))
+			}
+			if nonces[0] == 0 || nonces[0] != c.State.ConfigID() {
+				t.Errorf("want_config_id = %d, State.ConfigID = %d", nonces[0], c.State.ConfigID())
+			}
+			if got := c.State.NodeInfo().GetMyNodeNum(); got != radio.NodeNum() {
+				t.Errorf("MyNodeNum = %d, want %d", got, radio.NodeNum())
+			}
+			if got := len(c.State.Nodes()); got != tt.wantNodes {
+				t.Errorf("%d nodes, want %d", got, tt.wantNodes)
+			}
+			if got := len(c.State.Channels()); got != tt.wantChannels {
+				t.Errorf("%d channels, want %d", got, tt.wantChannels)
+			}
+			if got := len(c.State.Configs()); got != tt.wantConfigs {
+				t.Errorf("%d configs, want %d", got, tt.wantConfigs)
+			}
+		})
+	}
+}
+
+func TestClientStaleConfigComplete(t *testing.T) {
+	clientEnd, radioEnd := net.Pipe()
+	c := transport.NewClient(transport.NewRadioStreamConn(clientEnd), false)
+	t.Cleanup(func() { _ = c.Close() })
+	radio := transport.NewRadioStreamConn(radioEnd)
+	t.Cleanup(func() { _ = radio.Close() })
+	requests := make(chan *meshtastic.ToRadio, 8)
+	go func() {
+		for {
+			data, err := radio.ReadBytes()
+			if err != nil {
+				return
+			}
+			msg := &meshtastic.ToRadio{}
+			if proto.Unmarshal(data, msg) == nil {
+				requests <- msg
+			}
+		}
+	}()
+	complete := func(id uint32) {
+		t.Helper()
+		data, err := proto.Marshal(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_ConfigCompleteId{ConfigCompleteId: id}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := radio.WriteBytes(data); err != nil {
+			t.Fatalf("sending config_complete_id: %v", err)
+		}
+	}
+
+	connected := make(chan error, 1)
+	go func() { connected <- c.Connect(testContext(t)) }()
+	nonce := waitFor(t, requests, "the want_config_id").GetWantConfigId()
+	complete(nonce + 1)
+	select {
+	case err := <-connected:
+		t.Fatalf("Connect returned %v after the config_complete_id of another request", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if c.State.Complete() {
+		t.Fatal("State complete after the config_complete_id of another request")
+	}
+	complete(nonce)
+	if err := waitFor(t, connected, "Connect to return"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if !c.State.Complete() {
+		t.Error("State not complete after the matching config_complete_id")
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		drop func(radio *fakeradio.Radio)
+	}{
+		{name: "dropped links", drop: (*fakeradio.Radio).DropLinks},
+		{name: "rebooted radio", drop: (*fakeradio.Radio).Reboot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{Channels: []*meshtastic.Channel{{Index: 0, Role: meshtastic.Channel_PRIMARY}}})
+			c := newClient(t, radio)
+			events := make(chan transport.EventType, 4)
+			for _, typ := range []transport.EventType{transport.EventDisconnected, transport.EventReconnected} {
+				c.Events.RegisterHandler(typ, func(event transport.Event) {
+					events <- event.Type
+				}, transport.ExecPolicy{Mode: transport.ExecSequential})
+			}
+			connect(t, c)
+
+			tt.drop(radio)
+			if got := waitFor(t, events, "the disconnect"); got != transport.EventDisconnected {
+				t.Fatalf("first event = %s, want %s", got, transport.EventDisconnected)
+			}
+			if got := waitFor(t, events, "the reconnect"); got != transport.EventReconnected {
+				t.Fatalf("second event = %s, want %s", got, transport.EventReconnected)
+			}
+			eventually(t, "the config download after reconnecting", c.State.Complete)
+
+			nonces := wantConfigIDs(radio)
+			if len(nonces) != 2 {
+				t.Fatalf("radio received %d want_config_id, want 2", len(nonces))
+			}
+			if nonces[1] != c.State.ConfigID() {
+				t.Errorf("second want_config_id = %d, State.ConfigID = %d", nonces[1], c.State.ConfigID())
+			}
+			if got := len(c.State.Channels()); got != 1 {
+				t.Errorf("%d channels after reconnecting, want 1", got)
+			}
+			if _, err := c.SendText(testContext(t), transport.BroadcastAddr, 0, "back"); err != nil {
+				t.Errorf("SendText after reconnecting: %v", err)
+			}
+		})
+	}
+}
+
+// wantConfigIDs returns the nonces of the want_config_id requests radio received, in order.
+func wantConfigIDs(radio *fakeradio.Radio) []uint32 {
+	var nonces []uint32
+	for _, msg := range radio.Received() {
+		if id, ok := msg.GetPayloadVariant().(*meshtastic.ToRadio_WantConfigId); ok {
+			nonces = append(nonces, id.WantConfigId)
+		}
+	}
+	return nonces
+}
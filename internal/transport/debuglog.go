@@ -0,0 +1,172 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+// maxDebugLine is the length after which a debug line without a line end is emitted anyway.
+const maxDebugLine = 1024
+
+// LogSink receives the log records parsed from the device debug console.
+type LogSink func(rec *meshtastic.LogRecord)
+
+var (
+	// ansiEscape matches the color codes the firmware puts around the level.
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	// firmwareLogLine matches lines like "INFO  | 13:06:59 45 [Router] Received routing from=0x0".
+	// The clock reads ??:??:?? while the device has no time; the number after it is the uptime in seconds.
+	firmwareLogLine = regexp.MustCompile(`^(TRACE|DEBUG|INFO|WARN|ERROR|CRIT)\s*\|\s*\S+\s+(\d+)\s+(?:\[([^\]]*)\]\s?)?(.*)$`)
+)
+
+// firmwareLevels maps the level names printed by the firmware to LogRecord levels.
+var firmwareLevels = map[string]meshtastic.LogRecord_Level{
+	"TRACE": meshtastic.LogRecord_TRACE,
+	"DEBUG": meshtastic.LogRecord_DEBUG,
+	"INFO":  meshtastic.LogRecord_INFO,
+	"WARN":  meshtastic.LogRecord_WARNING,
+	"ERROR": meshtastic.LogRecord_ERROR,
+	"CRIT":  meshtastic.LogRecord_CRITICAL,
+}
+
+// ParseLogLine parses a line of the firmware debug console into a LogRecord.
+// Time is set to the device uptime in seconds, not to a unix time as in the LogRecords the firmware sends itself.
+// Lines that do not follow the firmware format are returned as the message of a record with level UNSET.
+func ParseLogLine(line string) *meshtastic.LogRecord {
+	line = strings.TrimRight(ansiEscape.ReplaceAllString(line, ""), "\r\n")
+	m := firmwareLogLine.FindStringSubmatch(line)
+	if m == nil {
+		return &meshtastic.LogRecord{Message: line}
+	}
+	uptime, _ := strconv.ParseUint(m[2], 10, 32)
+	return &meshtastic.LogRecord{
+		Level:   firmwareLevels[m[1]],
+		Time:    uint32(uptime),
+		Source:  m[3],
+		Message: m[4],
+	}
+}
+
+// DebugLogParser reassembles the non-framed bytes of a StreamConn into lines and passes each line,
+// parsed with ParseLogLine, to its sinks. It implements io.Writer so it can be used as
+// StreamConn.DebugWriter or Client.DebugWriter, and is safe for concurrent use.
+type DebugLogParser struct {
+	mu    sync.Mutex
+	line  []byte
+	sinks []LogSink
+}
+
+// NewDebugLogParser creates a parser which delivers records to sinks.
+func NewDebugLogParser(sinks ...LogSink) *DebugLogParser {
+	return &DebugLogParser{sinks: sinks}
+}
+
+// Write implements io.Writer. Complete lines are parsed and delivered right away.
+func (p *DebugLogParser) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range b {
+		if c == '\n' {
+			p.emit()
+			continue
+		}
+		p.line = append(p.line, c)
+		if len(p.line) >= maxDebugLine {
+			p.emit()
+		}
+	}
+	return len(b), nil
+}
+
+// Flush delivers a pending partial line.
+func (p *DebugLogParser) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit()
+}
+
+// emit delivers the collected line with p.mu held. Blank lines are dropped.
+func (p *DebugLogParser) emit() {
+	line := bytes.TrimSpace(p.line)
+	p.line = p.line[:0]
+	if len(line) == 0 {
+		return
+	}
+	rec := ParseLogLine(string(line))
+	for _, sink := range p.sinks {
+		sink(rec)
+	}
+}
+
+// slogLevels maps LogRecord levels to slog levels.
+var slogLevels = map[meshtastic.LogRecord_Level]slog.Level{
+	meshtastic.LogRecord_TRACE:    slog.LevelDebug - 4,
+	meshtastic.LogRecord_DEBUG:    slog.LevelDebug,
+	meshtastic.LogRecord_INFO:     slog.LevelInfo,
+	meshtastic.LogRecord_WARNING:  slog.LevelWarn,
+	meshtastic.LogRecord_ERROR:    slog.LevelError,
+	meshtastic.LogRecord_CRITICAL: slog.LevelError + 4,
+}
+
+// SlogSink returns a LogSink which logs every record to logger, at the matching level and with the
+// source and uptime as attributes. Records with level UNSET are logged at info level.
+func SlogSink(logger *slog.Logger) LogSink {
+	return func(rec *meshtastic.LogRecord) {
+		level, ok := slogLevels[rec.GetLevel()]
+		if !ok {
+			level = slog.LevelInfo
+		}
+		attrs := make([]slog.Attr, 0, 2)
+		if rec.GetSource() != "" {
+			attrs = append(attrs, slog.String("source", rec.GetSource()))
+		}
+		if rec.GetLevel() != meshtastic.LogRecord_UNSET {
+			attrs = append(attrs, slog.Duration("uptime", time.Duration(rec.GetTime())*time.Second))
+		}
+		logger.LogAttrs(context.Background(), level, rec.GetMessage(), attrs...)
+	}
+}
+
+// WriterSink returns a LogSink which writes every record to w as a line stamped with the local time
+// it was received at, like "2006-01-02 15:04:05.000 INFO     [Router] 45s message". Write errors are ignored.
+func WriterSink(w io.Writer) LogSink {
+	var mu sync.Mutex
+	return func(rec *meshtastic.LogRecord) {
+		level := "-"
+		if rec.GetLevel() != meshtastic.LogRecord_UNSET {
+			level = rec.GetLevel().String()
+		}
+		var prefix string
+		if rec.GetSource() != "" {
+			prefix = "[" + rec.GetSource() + "] "
+		}
+		if rec.GetLevel() != meshtastic.LogRecord_UNSET {
+			prefix += strconv.FormatUint(uint64(rec.GetTime()), 10) + "s "
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = fmt.Fprintf(w, "%s %-8s %s%s\n", time.Now().Format("2006-01-02 15:04:05.000"), level, prefix, rec.GetMessage())
+	}
+}
+
+// DeviceLogSink returns a LogSink which passes every record through the client's inbound pipeline as a
+// FromRadio LogRecord, so middlewares and handlers registered for *meshtastic.LogRecord receive the
+// debug console output like the log records the radio sends itself.
+func (c *Client) DeviceLogSink() LogSink {
+	return func(rec *meshtastic.LogRecord) {
+		msg := &meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_LogRecord{LogRecord: rec}}
+		if err := c.receive(msg); err != nil {
+			c.log.Error("error processing device log", "err", err)
+		}
+	}
+}
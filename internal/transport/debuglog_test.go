@@ -0,0 +1,131 @@
+package transport_test
+
+import (
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *meshtastic.LogRecord
+	}{
+		{
+			name: "tagged line",
+			line: "INFO  | 13:06:59 45 [Router] Received routing from=0x0",
+			want: &meshtastic.LogRecord{Level: meshtastic.LogRecord_INFO, Time: 45, Source: "Router", Message: "Received routing from=0x0"},
+		},
+		{
+			name: "line without tag",
+			line: "DEBUG | 13:06:59 7 Using analog input 1",
+			want: &meshtastic.LogRecord{Level: meshtastic.LogRecord_DEBUG, Time: 7, Message: "Using analog input 1"},
+		},
+		{
+			name: "device without time",
+			line: "WARN  | ??:??:?? 3 [GPS] No GPS found",
+			want: &meshtastic.LogRecord{Level: meshtastic.LogRecord_WARNING, Time: 3, Source: "GPS", Message: "No GPS found"},
+		},
+		{
+			name: "ANSI colors and line end",
+			line: "\x1b[31mERROR\x1b[0m | 13:06:59 1200 [Power] Low battery\r\n",
+			want: &meshtastic.LogRecord{Level: meshtastic.LogRecord_ERROR, Time: 1200, Source: "Power", Message: "Low battery"},
+		},
+		{
+			name: "critical",
+			line: "CRIT  | 00:00:01 1 Out of memory",
+			want: &meshtastic.LogRecord{Level: meshtastic.LogRecord_CRITICAL, Time: 1, Message: "Out of memory"},
+		},
+		{
+			name: "unparseable line",
+			line: "ets Jun  8 2016 00:22:57",
+			want: &meshtastic.LogRecord{Message: "ets Jun  8 2016 00:22:57"},
+		},
+		{
+			name: "unknown level",
+			line: "NOTICE | 13:06:59 45 hello",
+			want: &meshtastic.LogRecord{Message: "NOTICE | 13:06:59 45 hello"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transport.ParseLogLine(tt.line); !proto.Equal(got, tt.want) {
+				t.Errorf("ParseLogLine(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebugLogParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		// flush flushes the parser after the writes.
+		flush bool
+		want  []*meshtastic.LogRecord
+	}{
+		{
+			name:   "one line per write",
+			writes: []string{"INFO  | 13:06:59 45 [Router] one\n", "DEBUG | 13:06:59 46 two\n"},
+			want: []*meshtastic.LogRecord{
+				{Level: meshtastic.LogRecord_INFO, Time: 45, Source: "Router", Message: "one"},
+				{Level: meshtastic.LogRecord_DEBUG, Time: 46, Message: "two"},
+			},
+		},
+		{
+			name:   "line split across writes",
+			writes: []string{"INFO  | 13:0", "6:59 45 [Rou", "ter] split\r", "\n"},
+			want:   []*meshtastic.LogRecord{{Level: meshtastic.LogRecord_INFO, Time: 45, Source: "Router", Message: "split"}},
+		},
+		{
+			name:   "several lines in one write",
+			writes: []string{"INFO  | 13:06:59 45 one\nINFO  | 13:06:59 45 two\nINFO  | 13:06"},
+			want: []*meshtastic.LogRecord{
+				{Level: meshtastic.LogRecord_INFO, Time: 45, Message: "one"},
+				{Level: meshtastic.LogRecord_INFO, Time: 45, Message: "two"},
+			},
+		},
+		{
+			name:   "ANSI colored line",
+			writes: []string{"\x1b[34mINFO \x1b[0m | 13:06:59 45 [\x1b[32mMesh\x1b[0m] colored\n"},
+			want:   []*meshtastic.LogRecord{{Level: meshtastic.LogRecord_INFO, Time: 45, Source: "Mesh", Message: "colored"}},
+		},
+		{
+			name:   "raw and blank lines",
+			writes: []string{"boot: garbage\n\n  \r\n"},
+			want:   []*meshtastic.LogRecord{{Message: "boot: garbage"}},
+		},
+		{
+			name:   "partial line held until flushed",
+			writes: []string{"WARN  | 13:06:59 45 pending"},
+			flush:  true,
+			want:   []*meshtastic.LogRecord{{Level: meshtastic.LogRecord_WARNING, Time: 45, Message: "pending"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []*meshtastic.LogRecord
+			p := transport.NewDebugLogParser(func(rec *meshtastic.LogRecord) { got = append(got, rec) })
+			for _, w := range tt.writes {
+				if n, err := p.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if tt.flush {
+				p.Flush()
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d records %v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if !proto.Equal(got[i], tt.want[i]) {
+					t.Errorf("record %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,41 @@
 package transport
 
 import (
+	"slices"
 	"sync"
+	"sync/atomic"
 )
 
 const (
 	// EventMeshPacketReceived is the event type for when a mesh packet is received.
 	EventMeshPacketReceived = "MeshPacketReceived"
+	// EventDisconnected is the event type for when the link to the radio is lost. Data holds the error.
+	EventDisconnected = "Disconnected"
+	// EventReconnected is the event type for when the link to the radio has been re-established.
+	// Data holds the number of attempts it took.
+	EventReconnected = "Reconnected"
+	// EventNodeUpdated is the event type for when a received packet updated the node database.
+	// Data holds a copy of the updated *Node.
+	EventNodeUpdated = "NodeUpdated"
+	// EventNodeAdded is the event type for when a node is seen for the first time. Data holds a NodeChange.
+	EventNodeAdded = "NodeAdded"
+	// EventNodeRenamed is the event type for when the long or short name of a node changed. Data holds a NodeChange.
+	EventNodeRenamed = "NodeRenamed"
+	// EventNodeMoved is the event type for when the position of a node changed. Data holds a NodeChange.
+	EventNodeMoved = "NodeMoved"
+	// EventChannelChanged is the event type for when a channel was added, changed or removed. Data holds a ChannelChange.
+	EventChannelChanged = "ChannelChanged"
+	// EventConfigChanged is the event type for when a config section was added, changed or removed. Data holds a ConfigChange.
+	EventConfigChanged = "ConfigChanged"
+	// EventModuleConfigChanged is the event type for when a module config was added, changed or removed.
+	// Data holds a ModuleConfigChange.
+	EventModuleConfigChanged = "ModuleConfigChanged"
+	// EventMetadataChanged is the event type for when the device metadata of the local node changed.
+	// Data holds a MetadataChange.
+	EventMetadataChanged = "MetadataChanged"
+	// EventMyInfoChanged is the event type for when the node info of the local node changed, such as its
+	// node number or reboot count. Data holds a MyInfoChange.
+	EventMyInfoChanged = "MyInfoChanged"
 )
 
 // EventType is a string representing the type of event.
@@ -16,38 +45,75 @@ type EventType string
 type Event struct {
 	Type EventType
 	Data interface{}
+	// Annotations holds the values middlewares attached to the message behind the event, if any.
+	Annotations Annotations
 }
 
 // EventHandler is a function that handles an event.
 type EventHandler func(event Event)
 
+// eventHandler is an EventHandler together with the executor scheduling its calls.
+type eventHandler struct {
+	handler EventHandler
+	exec    *executor
+}
+
 // EventDispatcher is a dispatcher for events.
 type EventDispatcher struct {
-	handlers map[EventType][]EventHandler
+	handlers map[EventType][]*eventHandler
 	mu       sync.RWMutex
+	inFlight sync.WaitGroup
+	dropped  atomic.Uint64
 }
 
 // NewEventDispatcher creates a new event dispatcher.
 func NewEventDispatcher() *EventDispatcher {
 	return &EventDispatcher{
-		handlers: make(map[EventType][]EventHandler),
+		handlers: make(map[EventType][]*eventHandler),
 	}
 }
 
 // RegisterHandler registers an event handler for a specific event type.
-func (d *EventDispatcher) RegisterHandler(eventType EventType, handler EventHandler) {
+// An optional ExecPolicy controls how calls are scheduled; by default every call runs in its own goroutine.
+// ExecPerSender orders events whose Data is a MeshPacket by sender.
+// It returns a function which unregisters the handler again; calls already scheduled still run.
+func (d *EventDispatcher) RegisterHandler(eventType EventType, handler EventHandler, policy ...ExecPolicy) (unregister func()) {
+	h := &eventHandler{
+		handler: handler,
+		exec:    newExecutor(firstPolicy(policy), &d.dropped, &d.inFlight),
+	}
 	d.mu.Lock()
-	defer d.mu.Unlock()
-	d.handlers[eventType] = append(d.handlers[eventType], handler)
+	d.handlers[eventType] = append(d.handlers[eventType], h)
+	d.mu.Unlock()
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		// Dispatch may be iterating over the current slice, so the handlers are copied instead of removed in place.
+		d.handlers[eventType] = slices.DeleteFunc(slices.Clone(d.handlers[eventType]), func(e *eventHandler) bool {
+			return e == h
+		})
+	}
 }
 
-// Dispatch sends an event to all registered handlers for the event type.
+// Dispatch sends an event to all registered handlers for the event type. The calls are scheduled after
+// the dispatcher is unlocked, so a handler may register further handlers.
 func (d *EventDispatcher) Dispatch(event Event) {
 	d.mu.RLock()
-	defer d.mu.RUnlock()
-	if handlers, found := d.handlers[event.Type]; found {
-		for _, handler := range handlers {
-			go handler(event)
-		}
+	handlers := d.handlers[event.Type]
+	d.mu.RUnlock()
+	key := senderKey(event.Data)
+	for _, h := range handlers {
+		handler := h.handler
+		h.exec.run(key, func() { handler(event) }, &d.inFlight)
 	}
 }
+
+// Dropped returns the number of events discarded because a handler's queue was full.
+func (d *EventDispatcher) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+// Wait blocks until all handlers started by Dispatch have returned.
+func (d *EventDispatcher) Wait() {
+	d.inFlight.Wait()
+}
@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"sync"
+	"sync/atomic"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+// DefaultExecQueueSize is the number of pending calls a handler buffers when ExecPolicy.QueueSize is zero.
+const DefaultExecQueueSize = 1024
+
+// ExecMode selects how calls to a handler are scheduled.
+type ExecMode int
+
+const (
+	// ExecConcurrent runs every call in its own goroutine, unordered and unbounded. This is the default.
+	ExecConcurrent ExecMode = iota
+	// ExecSequential runs calls one at a time in arrival order.
+	ExecSequential
+	// ExecPool runs calls on a bounded pool of ExecPolicy.Workers goroutines.
+	ExecPool
+	// ExecPerSender runs calls from the same sender node in arrival order, and calls from different
+	// senders in parallel on up to ExecPolicy.Workers goroutines.
+	ExecPerSender
+)
+
+// Overflow selects what happens to a call when the handler's queue is full.
+type Overflow int
+
+const (
+	// OverflowBlock makes the read loop wait until the handler catches up.
+	OverflowBlock Overflow = iota
+	// OverflowDropOldest discards the oldest pending call to make room.
+	OverflowDropOldest
+	// OverflowDropNewest discards the incoming call.
+	OverflowDropNewest
+)
+
+// ExecPolicy describes how a handler is executed. The zero value is ExecConcurrent.
+type ExecPolicy struct {
+	Mode ExecMode
+	// Workers is the number of goroutines for ExecPool and ExecPerSender. Zero means one.
+	Workers int
+	// QueueSize is the number of pending calls buffered per queue. Zero means DefaultExecQueueSize.
+	QueueSize int
+	// Overflow is applied when the queue is full.
+	Overflow Overflow
+}
+
+// executor schedules calls according to an ExecPolicy.
+type executor struct {
+	policy   ExecPolicy
+	queues   []*taskQueue
+	dropped  *atomic.Uint64
+	inFlight *sync.WaitGroup
+}
+
+// newExecutor creates an executor for policy. It returns nil for ExecConcurrent.
+// Dropped calls are counted in dropped and every accepted call is tracked by inFlight.
+func newExecutor(policy ExecPolicy, dropped *atomic.Uint64, inFlight *sync.WaitGroup) *executor {
+	if policy.Mode == ExecConcurrent {
+		return nil
+	}
+	if policy.Workers <= 0 {
+		policy.Workers = 1
+	}
+	if policy.QueueSize <= 0 {
+		policy.QueueSize = DefaultExecQueueSize
+	}
+	e := &executor{policy: policy, dropped: dropped, inFlight: inFlight}
+	switch policy.Mode {
+	case ExecSequential:
+		e.queues = []*taskQueue{newTaskQueue(e, 1)}
+	case ExecPool:
+		e.queues = []*taskQueue{newTaskQueue(e, policy.Workers)}
+	default:
+		for i := 0; i < policy.Workers; i++ {
+			e.queues = append(e.queues, newTaskQueue(e, 1))
+		}
+	}
+	return e
+}
+
+// run schedules fn. The key picks the queue for ExecPerSender and is ignored otherwise.
+// A nil executor runs fn in its own goroutine.
+func (e *executor) run(key uint32, fn func(), inFlight *sync.WaitGroup) {
+	if e == nil {
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			fn()
+		}()
+		return
+	}
+	e.queues[int(key%uint32(len(e.queues)))].push(fn)
+}
+
+// taskQueue is a bounded FIFO of calls drained by up to maxWorkers goroutines.
+// Workers are started on demand and exit once the queue is empty, so an idle queue holds no goroutines.
+type taskQueue struct {
+	e          *executor
+	mu         sync.Mutex
+	notFull    *sync.Cond
+	tasks      []func()
+	running    int
+	maxWorkers int
+}
+
+// newTaskQueue creates an empty queue for e.
+func newTaskQueue(e *executor, maxWorkers int) *taskQueue {
+	q := &taskQueue{e: e, maxWorkers: maxWorkers}
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push appends fn, applying the overflow policy when the queue is full.
+func (q *taskQueue) push(fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.tasks) >= q.e.policy.QueueSize {
+		switch q.e.policy.Overflow {
+		case OverflowDropNewest:
+			q.e.dropped.Add(1)
+			return
+		case OverflowDropOldest:
+			q.tasks = q.tasks[1:]
+			q.e.dropped.Add(1)
+			q.e.inFlight.Done()
+		default:
+			q.notFull.Wait()
+		}
+	}
+	q.e.inFlight.Add(1)
+	q.tasks = append(q.tasks, fn)
+	if q.running < q.maxWorkers {
+		q.running++
+		go q.work()
+	}
+}
+
+// work runs queued calls until the queue is empty.
+func (q *taskQueue) work() {
+	for {
+		q.mu.Lock()
+		if len(q.tasks) == 0 {
+			q.running--
+			q.mu.Unlock()
+			return
+		}
+		fn := q.tasks[0]
+		q.tasks[0] = nil
+		q.tasks = q.tasks[1:]
+		q.notFull.Signal()
+		q.mu.Unlock()
+
+		fn()
+		q.e.inFlight.Done()
+	}
+}
+
+// senderKey returns the node a message came from, used to order ExecPerSender calls.
+func senderKey(data any) uint32 {
+	switch d := data.(type) {
+	case *meshtastic.MeshPacket:
+		return d.GetFrom()
+	case *Node:
+		return d.Info.GetNum()
+	case NodeChange:
+		return d.After.Info.GetNum()
+	case RadioPacket:
+		return d.Packet.GetFrom()
+	}
+	return 0
+}
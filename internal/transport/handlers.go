@@ -1,8 +1,12 @@
 package transport
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -10,11 +14,31 @@ import (
 // MessageHandler defines the function signature for a handler that processes a protobuf message.
 type MessageHandler func(msg proto.Message)
 
+// PacketHandler defines the function signature for a handler that processes the decoded payload of a MeshPacket.
+// The packet carries the envelope metadata such as sender, channel, SNR and hop limit.
+type PacketHandler func(packet *meshtastic.MeshPacket, payload proto.Message)
+
+// messageHandler is a MessageHandler together with the executor scheduling its calls.
+type messageHandler struct {
+	handler MessageHandler
+	exec    *executor
+}
+
+// portHandler is a PacketHandler together with the payload type it expects and the executor scheduling its calls.
+type portHandler struct {
+	kind    proto.Message
+	handler PacketHandler
+	exec    *executor
+}
+
 // HandlerRegistry holds registered handlers for protobuf messages.
 type HandlerRegistry struct {
 	errorOnNoHandlers bool
 	mu                sync.RWMutex
-	handlers          map[string][]MessageHandler
+	handlers          map[string][]messageHandler
+	portHandlers      map[meshtastic.PortNum][]portHandler
+	inFlight          sync.WaitGroup
+	dropped           atomic.Uint64
 }
 
 // NewHandlerRegistry creates a new instance of HandlerRegistry. Set errorOnNoHandler to true if you want HandleMessage to return
@@ -22,12 +46,22 @@ type HandlerRegistry struct {
 func NewHandlerRegistry(errorOnNoHandler bool) *HandlerRegistry {
 	return &HandlerRegistry{
 		errorOnNoHandlers: errorOnNoHandler,
-		handlers:          make(map[string][]MessageHandler),
+		handlers:          make(map[string][]messageHandler),
+		portHandlers:      make(map[meshtastic.PortNum][]portHandler),
 	}
 }
 
+// firstPolicy returns the optional policy passed to a Register function.
+func firstPolicy(policy []ExecPolicy) ExecPolicy {
+	if len(policy) == 0 {
+		return ExecPolicy{}
+	}
+	return policy[0]
+}
+
 // RegisterHandler registers a handler for a specific protobuf message type.
-func (r *HandlerRegistry) RegisterHandler(msg proto.Message, handler MessageHandler) {
+// An optional ExecPolicy controls how calls are scheduled; by default every call runs in its own goroutine.
+func (r *HandlerRegistry) RegisterHandler(msg proto.Message, handler MessageHandler, policy ...ExecPolicy) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -36,28 +70,78 @@ func (r *HandlerRegistry) RegisterHandler(msg proto.Message, handler MessageHand
 		return // Could not get message name; consider logging or handling the error
 	}
 	name := string(msgName)
-	r.handlers[name] = append(r.handlers[name], handler)
+	r.handlers[name] = append(r.handlers[name], messageHandler{
+		handler: handler,
+		exec:    newExecutor(firstPolicy(policy), &r.dropped, &r.inFlight),
+	})
+}
+
+// RegisterPortHandler registers a handler for decoded MeshPackets on port. The payload is unmarshalled into a new
+// message of the same type as kind before the handler is called; a nil kind hands the handler a nil payload.
+// An optional ExecPolicy controls how calls are scheduled, as for RegisterHandler.
+func (r *HandlerRegistry) RegisterPortHandler(port meshtastic.PortNum, kind proto.Message, handler PacketHandler, policy ...ExecPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.portHandlers[port] = append(r.portHandlers[port], portHandler{
+		kind:    kind,
+		handler: handler,
+		exec:    newExecutor(firstPolicy(policy), &r.dropped, &r.inFlight),
+	})
 }
 
 // HandleMessage invokes all registered handlers for the provided protobuf message, in the order they were registered.
+// For a decoded MeshPacket the handlers registered for its port are invoked as well.
+// The calls are scheduled after the registry is unlocked, so a handler may register further handlers
+// even when its queue is full and the read loop waits for it.
 func (r *HandlerRegistry) HandleMessage(msg proto.Message) error {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
 	msgName := proto.MessageName(msg)
 	if msgName == "" {
 		return fmt.Errorf("failed to get message name for type: %T", msg) // Could not get message name; consider logging or handling the error
 	}
 	name := string(msgName)
 
-	if handlers, exists := r.handlers[name]; exists {
-		for _, handler := range handlers {
-			go handler(msg)
+	var portHandlers []portHandler
+	packet, isPacket := msg.(*meshtastic.MeshPacket)
+	r.mu.RLock()
+	handlers := r.handlers[name]
+	if isPacket && packet.GetDecoded() != nil {
+		portHandlers = r.portHandlers[packet.GetDecoded().GetPortnum()]
+	}
+	r.mu.RUnlock()
+
+	key := senderKey(msg)
+	for _, h := range handlers {
+		handler := h.handler
+		h.exec.run(key, func() { handler(msg) }, &r.inFlight)
+	}
+
+	var errs []error
+	for _, ph := range portHandlers {
+		var payload proto.Message
+		if ph.kind != nil {
+			payload = ph.kind.ProtoReflect().New().Interface()
+			if err := proto.Unmarshal(packet.GetDecoded().GetPayload(), payload); err != nil {
+				errs = append(errs, fmt.Errorf("decoding %s payload: %w", packet.GetDecoded().GetPortnum(), err))
+				continue
+			}
 		}
+		handler := ph.handler
+		ph.exec.run(key, func() { handler(packet, payload) }, &r.inFlight)
+	}
 
-	} else if r.errorOnNoHandlers {
+	if len(handlers) == 0 && len(portHandlers) == 0 && r.errorOnNoHandlers {
 		return fmt.Errorf("no handlers registered for message: %s", msgName)
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// Dropped returns the number of calls discarded because a handler's queue was full.
+func (r *HandlerRegistry) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// Wait blocks until all handlers started by HandleMessage have returned.
+func (r *HandlerRegistry) Wait() {
+	r.inFlight.Wait()
 }
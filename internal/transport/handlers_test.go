@@ -0,0 +1,126 @@
+package transport_test
+
+import (
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandlerOverflow(t *testing.T) {
+	tests := []struct {
+		name        string
+		overflow    transport.Overflow
+		wantHandled []uint32
+		wantDropped uint64
+	}{
+		{name: "drop newest", overflow: transport.OverflowDropNewest, wantHandled: []uint32{1, 2, 3}, wantDropped: 2},
+		{name: "drop oldest", overflow: transport.OverflowDropOldest, wantHandled: []uint32{1, 4, 5}, wantDropped: 2},
+		{name: "block", overflow: transport.OverflowBlock, wantHandled: []uint32{1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := transport.NewHandlerRegistry(false)
+			started := make(chan struct{}, 5)
+			gate := make(chan struct{})
+			var mu sync.Mutex
+			var handled []uint32
+			r.RegisterHandler(&meshtastic.MeshPacket{}, func(msg proto.Message) {
+				started <- struct{}{}
+				<-gate
+				mu.Lock()
+				handled = append(handled, msg.(*meshtastic.MeshPacket).GetId())
+				mu.Unlock()
+			}, transport.ExecPolicy{Mode: transport.ExecSequential, QueueSize: 2, Overflow: tt.overflow})
+
+			// The first call occupies the worker, the next two fill the queue.
+			_ = r.HandleMessage(&meshtastic.MeshPacket{Id: 1})
+			waitFor(t, started, "the first call")
+			pushed := make(chan struct{})
+			go func() {
+				defer close(pushed)
+				for id := uint32(2); id <= 5; id++ {
+					_ = r.HandleMessage(&meshtastic.MeshPacket{Id: id})
+				}
+			}()
+			if tt.overflow == transport.OverflowBlock {
+				select {
+				case <-pushed:
+					t.Fatal("HandleMessage did not block on the full queue")
+				case <-time.After(50 * time.Millisecond):
+				}
+			} else {
+				waitFor(t, pushed, "HandleMessage to return")
+			}
+			close(gate)
+			waitFor(t, pushed, "HandleMessage to return")
+			r.Wait()
+
+			if !slices.Equal(handled, tt.wantHandled) {
+				t.Errorf("handled %v, want %v", handled, tt.wantHandled)
+			}
+			if got := r.Dropped(); got != tt.wantDropped {
+				t.Errorf("Dropped = %d, want %d", got, tt.wantDropped)
+			}
+		})
+	}
+}
+
+// A handler registering handlers must not deadlock with the read loop waiting for room in its queue.
+func TestHandlerRegistersWhileQueueFull(t *testing.T) {
+	r := transport.NewHandlerRegistry(false)
+	gate := make(chan struct{})
+	started := make(chan struct{}, 3)
+	r.RegisterHandler(&meshtastic.MeshPacket{}, func(proto.Message) {
+		started <- struct{}{}
+		<-gate
+		r.RegisterHandler(&meshtastic.NodeInfo{}, func(proto.Message) {})
+	}, transport.ExecPolicy{Mode: transport.ExecSequential, QueueSize: 1})
+
+	_ = r.HandleMessage(&meshtastic.MeshPacket{Id: 1})
+	waitFor(t, started, "the first call")
+	_ = r.HandleMessage(&meshtastic.MeshPacket{Id: 2})
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		_ = r.HandleMessage(&meshtastic.MeshPacket{Id: 3})
+	}()
+	// Let the third call block on the full queue before the handler registers.
+	time.Sleep(50 * time.Millisecond)
+	close(gate)
+	waitFor(t, blocked, "the blocked HandleMessage to return")
+	r.Wait()
+}
+
+func TestHandlerPerSenderOrder(t *testing.T) {
+	const senders, perSender = 5, 50
+	r := transport.NewHandlerRegistry(false)
+	var mu sync.Mutex
+	got := make(map[uint32][]uint32)
+	r.RegisterHandler(&meshtastic.MeshPacket{}, func(msg proto.Message) {
+		packet := msg.(*meshtastic.MeshPacket)
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+		mu.Lock()
+		got[packet.GetFrom()] = append(got[packet.GetFrom()], packet.GetId())
+		mu.Unlock()
+	}, transport.ExecPolicy{Mode: transport.ExecPerSender, Workers: 3})
+
+	for id := uint32(1); id <= perSender; id++ {
+		for from := uint32(1); from <= senders; from++ {
+			_ = r.HandleMessage(&meshtastic.MeshPacket{From: from, Id: id})
+		}
+	}
+	r.Wait()
+	for from := uint32(1); from <= senders; from++ {
+		ids := got[from]
+		if len(ids) != perSender || !slices.IsSorted(ids) {
+			t.Errorf("sender %d handled out of order: %v", from, ids)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"context"
+	"time"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+// heartbeatLoop periodically sends a heartbeat to the radio and, when the link has been quiet for a whole
+// interval, probes whether the radio still answers. It stops when the client is closed.
+func (c *Client) heartbeatLoop() {
+	ticker := time.NewTicker(c.HeartbeatInterval)
+	defer ticker.Stop()
+	heartbeat := &meshtastic.ToRadio{
+		PayloadVariant: &meshtastic.ToRadio_Heartbeat{Heartbeat: &meshtastic.Heartbeat{}},
+	}
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			if !c.State.Complete() {
+				// Still syncing or in the middle of a reconnect.
+				continue
+			}
+			sc := c.conn()
+			if err := c.write(c.ctx, heartbeat); err != nil {
+				c.log.Warn("sending heartbeat", "err", err)
+				c.dropLink(sc)
+				continue
+			}
+			if c.LivenessTimeout > 0 && now.Sub(sc.LastRead()) >= c.HeartbeatInterval {
+				c.probe(sc)
+			}
+		}
+	}
+}
+
+// probe asks the radio for its device metadata, which unlike a heartbeat it answers, and drops sc when
+// nothing at all is read from it within LivenessTimeout. A quiet mesh therefore does not cost the link.
+func (c *Client) probe(sc *StreamConn) {
+	sent := time.Now()
+	ctx, cancel := context.WithTimeout(c.ctx, c.LivenessTimeout)
+	defer cancel()
+	_, err := c.Admin(ctx, &meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_GetDeviceMetadataRequest{GetDeviceMetadataRequest: true},
+	})
+	if err == nil || sc.LastRead().After(sent) || c.ctx.Err() != nil {
+		return
+	}
+	c.log.Warn("radio is not responding", "silent", time.Since(sc.LastRead()).Round(time.Second), "err", err)
+	c.dropLink(sc)
+}
+
+// dropLink closes sc so that the read loop notices the failure and hands it to the reconnect logic.
+func (c *Client) dropLink(sc *StreamConn) {
+	if c.conn() != sc || c.ctx.Err() != nil {
+		return
+	}
+	c.stale.Store(true)
+	if err := sc.Close(); err != nil {
+		c.log.Debug("closing unresponsive link", "err", err)
+	}
+}
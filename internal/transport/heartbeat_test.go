@@ -0,0 +1,88 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+)
+
+// stallConn discards everything the radio sends while stalled, like a radio which hung with the link up.
+type stallConn struct {
+	io.ReadWriteCloser
+	stalled *atomic.Bool
+}
+
+func (c stallConn) Read(p []byte) (int, error) {
+	for {
+		n, err := c.ReadWriteCloser.Read(p)
+		if err != nil || !c.stalled.Load() {
+			return n, err
+		}
+	}
+}
+
+func TestHeartbeatLiveness(t *testing.T) {
+	tests := []struct {
+		name  string
+		stall bool
+	}{
+		{name: "quiet mesh keeps the link"},
+		{name: "hung radio is redialed", stall: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{})
+			var stalled atomic.Bool
+			var dials atomic.Int32
+			c := transport.NewDialClient(func(context.Context) (*transport.StreamConn, error) {
+				conn := radio.Pipe()
+				if dials.Add(1) == 1 {
+					// Only the first link hangs, so the client can reconnect.
+					conn = stallConn{ReadWriteCloser: conn, stalled: &stalled}
+				}
+				return transport.NewRadioStreamConn(conn), nil
+			}, false)
+			c.Backoff = transport.Backoff{Initial: 10 * time.Millisecond, Max: 10 * time.Millisecond, Multiplier: 1}
+			c.HeartbeatInterval = 20 * time.Millisecond
+			c.LivenessTimeout = 100 * time.Millisecond
+			t.Cleanup(func() { _ = c.Close() })
+			disconnected := make(chan error, 1)
+			c.Events.RegisterHandler(transport.EventDisconnected, func(e transport.Event) {
+				select {
+				case disconnected <- e.Data.(error):
+				default:
+				}
+			})
+			connect(t, c)
+			stalled.Store(tt.stall)
+
+			if !tt.stall {
+				select {
+				case err := <-disconnected:
+					t.Fatalf("quiet link dropped: %v", err)
+				case <-time.After(500 * time.Millisecond):
+				}
+				probes := 0
+				for _, msg := range radio.Received() {
+					if msg.GetPacket().GetDecoded() != nil {
+						probes++
+					}
+				}
+				if probes == 0 {
+					t.Error("no liveness probe was sent")
+				}
+				return
+			}
+			if err := waitFor(t, disconnected, "the hung link to be dropped"); !errors.Is(err, transport.ErrNoResponse) {
+				t.Errorf("disconnect cause = %v, want ErrNoResponse", err)
+			}
+			eventually(t, "the reconnect", func() bool { return dials.Load() >= 2 && c.State.Complete() })
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package transport_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+)
+
+// testTimeout bounds every wait of a test, so a deadlock fails the test instead of hanging it.
+const testTimeout = 5 * time.Second
+
+// newRadio creates a fake radio which is closed when the test ends.
+func newRadio(t *testing.T, cfg fakeradio.Config) *fakeradio.Radio {
+	t.Helper()
+	radio := fakeradio.New(cfg)
+	t.Cleanup(func() { _ = radio.Close() })
+	return radio
+}
+
+// newClient creates a client dialing radio, with fast reconnects, which is closed and waited for when the
+// test ends.
+func newClient(t *testing.T, radio *fakeradio.Radio) *transport.Client {
+	t.Helper()
+	c := transport.NewDialClient(radio.Dialer(), false)
+	c.Backoff = transport.Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2}
+	t.Cleanup(func() {
+		_ = c.Close()
+		c.Wait()
+	})
+	return c
+}
+
+// connect connects c and fails the test when that does not succeed in time.
+func connect(t *testing.T, c *transport.Client) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+}
+
+// testContext returns a context which is done after testTimeout or when the test ends.
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// waitFor fails the test unless ch is closed or receives in time.
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	var zero T
+	return zero
+}
+
+// eventually fails the test unless cond becomes true in time.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// LinkStats is a snapshot of the health counters of a StreamConn.
+// A growing number of resyncs, oversize frames or decode errors usually points at a flaky cable or port.
+type LinkStats struct {
+	// FramesIn and FramesOut count the complete frames read and written.
+	FramesIn  uint64
+	FramesOut uint64
+	// BytesIn and BytesOut count every byte on the wire, including frame headers, wake preambles and debug output.
+	BytesIn  uint64
+	BytesOut uint64
+	// DebugBytes counts the non-framed bytes read, usually device log output.
+	DebugBytes uint64
+	// Resyncs counts the times a Start1 byte was not followed by Start2 and the reader had to look for the next frame.
+	Resyncs uint64
+	// Oversize counts the frames dropped because their header announced more than PacketMTU bytes.
+	Oversize uint64
+	// DecodeErrors counts the frames whose protobuf payload could not be unmarshalled.
+	DecodeErrors uint64
+	// WriteErrors counts the failed frame writes.
+	WriteErrors uint64
+	// LastWriteLatency, AvgWriteLatency and MaxWriteLatency describe how long successful frame writes took,
+	// not counting the wake preamble.
+	LastWriteLatency time.Duration
+	AvgWriteLatency  time.Duration
+	MaxWriteLatency  time.Duration
+}
+
+// LogValue implements slog.LogValuer so a snapshot can be logged as a group.
+func (s LinkStats) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("frames_in", s.FramesIn),
+		slog.Uint64("frames_out", s.FramesOut),
+		slog.Uint64("bytes_in", s.BytesIn),
+		slog.Uint64("bytes_out", s.BytesOut),
+		slog.Uint64("debug_bytes", s.DebugBytes),
+		slog.Uint64("resyncs", s.Resyncs),
+		slog.Uint64("oversize", s.Oversize),
+		slog.Uint64("decode_errors", s.DecodeErrors),
+		slog.Uint64("write_errors", s.WriteErrors),
+		slog.Duration("write_latency_avg", s.AvgWriteLatency),
+		slog.Duration("write_latency_max", s.MaxWriteLatency),
+	)
+}
+
+// linkCounters holds the live counters behind LinkStats.
+type linkCounters struct {
+	framesIn, framesOut       atomic.Uint64
+	bytesIn, bytesOut         atomic.Uint64
+	debugBytes                atomic.Uint64
+	resyncs, oversize         atomic.Uint64
+	decodeErrors, writeErrors atomic.Uint64
+	// lastWrite, totalWrite and maxWrite hold write latencies in nanoseconds.
+	lastWrite, totalWrite, maxWrite atomic.Int64
+}
+
+// wrote records a successful frame write which took d.
+func (l *linkCounters) wrote(d time.Duration) {
+	l.framesOut.Add(1)
+	l.lastWrite.Store(int64(d))
+	l.totalWrite.Add(int64(d))
+	for {
+		m := l.maxWrite.Load()
+		if int64(d) <= m || l.maxWrite.CompareAndSwap(m, int64(d)) {
+			return
+		}
+	}
+}
+
+// snapshot returns the current counters.
+func (l *linkCounters) snapshot() LinkStats {
+	s := LinkStats{
+		FramesIn:         l.framesIn.Load(),
+		FramesOut:        l.framesOut.Load(),
+		BytesIn:          l.bytesIn.Load(),
+		BytesOut:         l.bytesOut.Load(),
+		DebugBytes:       l.debugBytes.Load(),
+		Resyncs:          l.resyncs.Load(),
+		Oversize:         l.oversize.Load(),
+		DecodeErrors:     l.decodeErrors.Load(),
+		WriteErrors:      l.writeErrors.Load(),
+		LastWriteLatency: time.Duration(l.lastWrite.Load()),
+		MaxWriteLatency:  time.Duration(l.maxWrite.Load()),
+	}
+	if s.FramesOut > 0 {
+		s.AvgWriteLatency = time.Duration(l.totalWrite.Load() / int64(s.FramesOut))
+	}
+	return s
+}
+
+// Stats returns a snapshot of the health counters of the connection.
+func (c *StreamConn) Stats() LinkStats {
+	return c.stats.snapshot()
+}
+
+// LinkStats returns the health counters of the current link to the radio.
+// The counters start over when the client reconnects.
+func (c *Client) LinkStats() LinkStats {
+	if sc := c.conn(); sc != nil {
+		return sc.Stats()
+	}
+	return LinkStats{}
+}
+
+// linkStatsLoop logs a snapshot of the link counters every LinkStatsInterval until the client is closed.
+func (c *Client) linkStatsLoop() {
+	ticker := time.NewTicker(c.LinkStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.log.Info("link stats", "link", c.LinkStats())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package transport
+
+import (
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// LocalConfig returns the config of the radio with the current value of every section it reported.
+// Sections the radio did not report are nil.
+func (s *State) LocalConfig() *meshtastic.LocalConfig {
+	s.RLock()
+	defer s.RUnlock()
+	if s.local == nil {
+		return &meshtastic.LocalConfig{}
+	}
+	return proto.Clone(s.local).(*meshtastic.LocalConfig)
+}
+
+// LocalModuleConfig returns the module config of the radio with the current value of every module it reported.
+// Modules the radio did not report are nil.
+func (s *State) LocalModuleConfig() *meshtastic.LocalModuleConfig {
+	s.RLock()
+	defer s.RUnlock()
+	if s.localModules == nil {
+		return &meshtastic.LocalModuleConfig{}
+	}
+	return proto.Clone(s.localModules).(*meshtastic.LocalModuleConfig)
+}
+
+// rebuildLocal sets local and localModules from the configs and modules held, with s locked.
+func (s *State) rebuildLocal() {
+	s.local, s.localModules = &meshtastic.LocalConfig{}, &meshtastic.LocalModuleConfig{}
+	for _, cfg := range s.configs {
+		setSection(s.local, cfg)
+	}
+	for _, cfg := range s.modules {
+		setSection(s.localModules, cfg)
+	}
+}
+
+// configSection returns a copy of the section get reads from the LocalConfig of s, or nil.
+func configSection[T proto.Message](s *State, get func(*meshtastic.LocalConfig) T) T {
+	s.RLock()
+	defer s.RUnlock()
+	return proto.Clone(get(s.local)).(T)
+}
+
+// moduleSection returns a copy of the module config get reads from the LocalModuleConfig of s, or nil.
+func moduleSection[T proto.Message](s *State, get func(*meshtastic.LocalModuleConfig) T) T {
+	s.RLock()
+	defer s.RUnlock()
+	return proto.Clone(get(s.localModules)).(T)
+}
+
+// setSection copies the section set in the payload variant of cfg into the field of local with the same name.
+// LocalConfig and LocalModuleConfig name their fields like the variants of Config and ModuleConfig.
+func setSection(local, cfg proto.Message) {
+	m := cfg.ProtoReflect()
+	oneof := m.Descriptor().Oneofs().ByName("payload_variant")
+	if oneof == nil {
+		return
+	}
+	variant := m.WhichOneof(oneof)
+	if variant == nil || variant.Message() == nil {
+		return
+	}
+	l := local.ProtoReflect()
+	field := l.Descriptor().Fields().ByName(variant.Name())
+	if field == nil || field.Message() == nil {
+		// Variants such as the session key are no config section.
+		return
+	}
+	section := proto.Clone(m.Get(variant).Message().Interface())
+	l.Set(field, protoreflect.ValueOfMessage(section.ProtoReflect()))
+}
+
+// Device returns the device section of the radio config, or nil when the radio has not reported it.
+func (s *State) Device() *meshtastic.Config_DeviceConfig {
+	return configSection(s, (*meshtastic.LocalConfig).GetDevice)
+}
+
+// Position returns the position section of the radio config.
+func (s *State) Position() *meshtastic.Config_PositionConfig {
+	return configSection(s, (*meshtastic.LocalConfig).GetPosition)
+}
+
+// Power returns the power section of the radio config.
+func (s *State) Power() *meshtastic.Config_PowerConfig {
+	return configSection(s, (*meshtastic.LocalConfig).GetPower)
+}
+
+// Network returns the network section of the radio config.
+func (s *State) Network() *meshtastic.Config_NetworkConfig {
+	return configSection(s, (*meshtastic.LocalConfig).GetNetwork)
+}
+
+// Display returns the display section of the radio config.
+func (s *State) Display() *meshtastic.Config_DisplayConfig {
+	return configSection(s, (*meshtastic.LocalConfig).GetDisplay)
+}
+
+// LoRa returns the LoRa section of the radio config.
+func (s *State) LoRa() *meshtastic.Config_LoRaConfig {
+	return configSection(s, (*meshtastic.LocalConfig).GetLora)
+}
+
+// Bluetooth returns the Bluetooth section of the radio config.
+func (s *State) Bluetooth() *meshtastic.Config_BluetoothConfig {
+	return configSection(s, (*meshtastic.LocalConfig).GetBluetooth)
+}
+
+// Security returns the security section of the radio config.
+func (s *State) Security() *meshtastic.Config_SecurityConfig {
+	return configSection(s, (*meshtastic.LocalConfig).GetSecurity)
+}
+
+// MQTT returns the config of the MQTT module, or nil when the radio has not reported it.
+func (s *State) MQTT() *meshtastic.ModuleConfig_MQTTConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetMqtt)
+}
+
+// Serial returns the config of the serial module.
+func (s *State) Serial() *meshtastic.ModuleConfig_SerialConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetSerial)
+}
+
+// ExternalNotification returns the config of the external notification module.
+func (s *State) ExternalNotification() *meshtastic.ModuleConfig_ExternalNotificationConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetExternalNotification)
+}
+
+// StoreForward returns the config of the store and forward module.
+func (s *State) StoreForward() *meshtastic.ModuleConfig_StoreForwardConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetStoreForward)
+}
+
+// RangeTest returns the config of the range test module.
+func (s *State) RangeTest() *meshtastic.ModuleConfig_RangeTestConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetRangeTest)
+}
+
+// Telemetry returns the config of the telemetry module.
+func (s *State) Telemetry() *meshtastic.ModuleConfig_TelemetryConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetTelemetry)
+}
+
+// CannedMessage returns the config of the canned message module.
+func (s *State) CannedMessage() *meshtastic.ModuleConfig_CannedMessageConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetCannedMessage)
+}
+
+// Audio returns the config of the audio module.
+func (s *State) Audio() *meshtastic.ModuleConfig_AudioConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetAudio)
+}
+
+// RemoteHardware returns the config of the remote hardware module.
+func (s *State) RemoteHardware() *meshtastic.ModuleConfig_RemoteHardwareConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetRemoteHardware)
+}
+
+// NeighborInfo returns the config of the neighbor info module.
+func (s *State) NeighborInfo() *meshtastic.ModuleConfig_NeighborInfoConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetNeighborInfo)
+}
+
+// AmbientLighting returns the config of the ambient lighting module.
+func (s *State) AmbientLighting() *meshtastic.ModuleConfig_AmbientLightingConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetAmbientLighting)
+}
+
+// DetectionSensor returns the config of the detection sensor module.
+func (s *State) DetectionSensor() *meshtastic.ModuleConfig_DetectionSensorConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetDetectionSensor)
+}
+
+// Paxcounter returns the config of the paxcounter module.
+func (s *State) Paxcounter() *meshtastic.ModuleConfig_PaxcounterConfig {
+	return moduleSection(s, (*meshtastic.LocalModuleConfig).GetPaxcounter)
+}
@@ -0,0 +1,82 @@
+package transport_test
+
+import (
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+func TestLocalConfigLoRa(t *testing.T) {
+	tests := []struct {
+		name string
+		// refresh makes the radio report its LoRa section again.
+		refresh func(t *testing.T, c *transport.Client, radio *fakeradio.Radio)
+	}{
+		{
+			name: "re-sync",
+			refresh: func(t *testing.T, c *transport.Client, radio *fakeradio.Radio) {
+				radio.DropLinks()
+				eventually(t, "the config download after reconnecting", func() bool {
+					return c.State.Complete() && len(wantConfigIDs(radio)) == 2
+				})
+			},
+		},
+		{
+			name: "get_config_response",
+			refresh: func(t *testing.T, c *transport.Client, radio *fakeradio.Radio) {
+				if _, err := c.GetConfig(testContext(t), meshtastic.AdminMessage_LORA_CONFIG); err != nil {
+					t.Fatalf("GetConfig: %v", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{
+				Configs: []*meshtastic.Config{
+					loraConfig(meshtastic.Config_LoRaConfig_EU_868),
+					{PayloadVariant: &meshtastic.Config_Device{Device: &meshtastic.Config_DeviceConfig{Role: meshtastic.Config_DeviceConfig_ROUTER}}},
+				},
+			})
+			c := newClient(t, radio)
+			connect(t, c)
+			if got := c.State.LoRa().GetRegion(); got != meshtastic.Config_LoRaConfig_EU_868 {
+				t.Fatalf("LoRa region after connecting = %s, want %s", got, meshtastic.Config_LoRaConfig_EU_868)
+			}
+
+			// An unsolicited report replaces the section, until the radio reports its own again.
+			radio.Send(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_Config{Config: loraConfig(meshtastic.Config_LoRaConfig_US)}})
+			eventually(t, "the second LoRa section", func() bool {
+				return c.State.LoRa().GetRegion() == meshtastic.Config_LoRaConfig_US
+			})
+			tt.refresh(t, c, radio)
+			if got := c.State.LoRa().GetRegion(); got != meshtastic.Config_LoRaConfig_EU_868 {
+				t.Errorf("LoRa region = %s, want the newer %s", got, meshtastic.Config_LoRaConfig_EU_868)
+			}
+			if got := c.State.LocalConfig().GetLora().GetRegion(); got != meshtastic.Config_LoRaConfig_EU_868 {
+				t.Errorf("LocalConfig LoRa region = %s, want %s", got, meshtastic.Config_LoRaConfig_EU_868)
+			}
+			if got := c.State.Device().GetRole(); got != meshtastic.Config_DeviceConfig_ROUTER {
+				t.Errorf("device role = %s, want %s", got, meshtastic.Config_DeviceConfig_ROUTER)
+			}
+			if got := len(c.State.Configs()); got != 2 {
+				t.Errorf("%d config sections, want 2", got)
+			}
+			// The accessors hand out copies.
+			c.State.LoRa().Region = meshtastic.Config_LoRaConfig_ANZ
+			if got := c.State.LoRa().GetRegion(); got != meshtastic.Config_LoRaConfig_EU_868 {
+				t.Errorf("LoRa region after changing a copy = %s", got)
+			}
+			if c.State.MQTT() != nil {
+				t.Error("MQTT config of a radio which did not report it")
+			}
+		})
+	}
+}
+
+// loraConfig returns a LoRa config section for region.
+func loraConfig(region meshtastic.Config_LoRaConfig_RegionCode) *meshtastic.Config {
+	return &meshtastic.Config{PayloadVariant: &meshtastic.Config_Lora{Lora: &meshtastic.Config_LoRaConfig{Region: region}}}
+}
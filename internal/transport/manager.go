@@ -0,0 +1,225 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+// DefaultManagerDedupWindow is how long a Manager remembers a packet to drop the copies heard by its other radios.
+const DefaultManagerDedupWindow = 10 * time.Minute
+
+var (
+	// ErrUnknownRadio is returned when a Manager is asked to use a radio it does not hold.
+	ErrUnknownRadio = errors.New("unknown radio")
+	// ErrDuplicateRadio is returned when a radio is added to a Manager twice, for example over serial and TCP.
+	ErrDuplicateRadio = errors.New("radio already added")
+)
+
+// RadioPacket is a packet together with the radio it was received by. It is the Data of the
+// EventMeshPacketReceived events of a Manager.
+type RadioPacket struct {
+	// Radio is the node number of the receiving radio.
+	Radio  uint32
+	Packet *meshtastic.MeshPacket
+}
+
+// Manager runs a Client per radio and merges what they receive. Radios are labelled by their node number.
+type Manager struct {
+	mu      sync.RWMutex
+	clients map[uint32]*Client
+	order   []uint32
+	// unregister removes the handlers passing the packets of each radio on to Events.
+	unregister map[uint32]func()
+	dedup      *packetDedup
+	log        *slog.Logger
+
+	// Events receives EventMeshPacketReceived with a RadioPacket for every packet, once even when several
+	// radios heard it. Duplicates are recognized by sender and packet ID.
+	Events *EventDispatcher
+}
+
+// NewManager creates a Manager without radios.
+func NewManager() *Manager {
+	return &Manager{
+		clients:    make(map[uint32]*Client),
+		unregister: make(map[uint32]func()),
+		dedup:      newPacketDedup(DefaultManagerDedupWindow),
+		log:        slog.Default().WithGroup("manager"),
+		Events:     NewEventDispatcher(),
+	}
+}
+
+// Add connects c and adds it to the manager under the node number of its radio, which it returns.
+// The packets c receives are passed on to Events from then on. On error c is left as it is, without
+// feeding Events, and the caller remains responsible for closing it.
+func (m *Manager) Add(ctx context.Context, c *Client) (uint32, error) {
+	if err := c.Connect(ctx); err != nil {
+		return 0, err
+	}
+	num := c.State.NodeInfo().GetMyNodeNum()
+	if num == 0 {
+		return 0, ErrNotConnected
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.clients[num]; ok {
+		return 0, fmt.Errorf("%w: %s", ErrDuplicateRadio, NodeID(num))
+	}
+	m.clients[num] = c
+	m.order = append(m.order, num)
+	m.unregister[num] = c.Events.RegisterHandler(EventMeshPacketReceived, func(event Event) {
+		if packet, ok := event.Data.(*meshtastic.MeshPacket); ok {
+			m.receive(num, packet, event.Annotations)
+		}
+	})
+	m.log.Info("radio added", "radio", NodeID(num))
+	return num, nil
+}
+
+// Remove takes the radio with node number num out of the manager and closes its client. The packets it
+// still receives are no longer passed on to Events.
+func (m *Manager) Remove(num uint32) error {
+	m.mu.Lock()
+	c, ok := m.clients[num]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownRadio, NodeID(num))
+	}
+	m.unregister[num]()
+	delete(m.unregister, num)
+	delete(m.clients, num)
+	m.order = slices.DeleteFunc(m.order, func(n uint32) bool { return n == num })
+	m.mu.Unlock()
+	m.log.Info("radio removed", "radio", NodeID(num))
+	return c.Close()
+}
+
+// receive passes packet on to the manager's handlers unless another radio already received it.
+func (m *Manager) receive(radio uint32, packet *meshtastic.MeshPacket, annotations Annotations) {
+	if !m.dedup.first(packet) {
+		return
+	}
+	m.Events.Dispatch(Event{
+		Type:        EventMeshPacketReceived,
+		Data:        RadioPacket{Radio: radio, Packet: packet},
+		Annotations: annotations,
+	})
+}
+
+// Radios returns the node numbers of the radios in the order they were added.
+func (m *Manager) Radios() []uint32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]uint32(nil), m.order...)
+}
+
+// Radio returns the client of the radio with node number num. Zero selects the radio added first.
+func (m *Manager) Radio(num uint32) (*Client, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if num == 0 && len(m.order) > 0 {
+		num = m.order[0]
+	}
+	c, ok := m.clients[num]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRadio, NodeID(num))
+	}
+	return c, nil
+}
+
+// clientList returns the clients in the order they were added.
+func (m *Manager) clientList() []*Client {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	clients := make([]*Client, 0, len(m.order))
+	for _, num := range m.order {
+		clients = append(clients, m.clients[num])
+	}
+	return clients
+}
+
+// Nodes returns the nodes known to any radio, ordered by node number. A node known to several radios is
+// returned as the radio which heard it last has it.
+func (m *Manager) Nodes() []*Node {
+	merged := make(map[uint32]*Node)
+	for _, c := range m.clientList() {
+		for _, node := range c.State.NodeDB().All() {
+			known, ok := merged[node.Info.GetNum()]
+			if !ok || node.Info.GetLastHeard() > known.Info.GetLastHeard() {
+				merged[node.Info.GetNum()] = node
+			}
+		}
+	}
+	nodes := make([]*Node, 0, len(merged))
+	for _, node := range merged {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Info.GetNum() < nodes[j].Info.GetNum() })
+	return nodes
+}
+
+// Lookup returns the node named by id as the radio which heard it last has it, see NodeDB.Lookup.
+func (m *Manager) Lookup(id string) (*Node, bool) {
+	var found *Node
+	for _, c := range m.clientList() {
+		node, ok := c.State.NodeDB().Lookup(id)
+		if ok && (found == nil || node.Info.GetLastHeard() > found.Info.GetLastHeard()) {
+			found = node
+		}
+	}
+	return found, found != nil
+}
+
+// SendPacket sends packet through the radio with node number radio, or the radio added first when radio is zero.
+func (m *Manager) SendPacket(ctx context.Context, radio uint32, packet *meshtastic.MeshPacket) error {
+	c, err := m.Radio(radio)
+	if err != nil {
+		return err
+	}
+	return c.SendPacket(ctx, packet)
+}
+
+// SendText sends text through the radio with node number radio, or the radio added first when radio is zero.
+func (m *Manager) SendText(ctx context.Context, radio, to, channel uint32, text string) (*meshtastic.MeshPacket, error) {
+	c, err := m.Radio(radio)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendText(ctx, to, channel, text)
+}
+
+// Close stops passing packets on to Events and closes the clients of all radios. Like Client.Close it
+// does not wait for the handlers, so it may be called from one; call Wait for that.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	for num, unregister := range m.unregister {
+		unregister()
+		delete(m.unregister, num)
+	}
+	m.mu.Unlock()
+	var errs []error
+	for _, c := range m.clientList() {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Wait blocks until the clients of all radios and the manager's handlers are done, see Client.Wait.
+// It must not be called from a handler.
+func (m *Manager) Wait() {
+	for _, c := range m.clientList() {
+		c.Wait()
+	}
+	m.Events.Wait()
+}
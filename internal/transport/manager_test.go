@@ -0,0 +1,182 @@
+package transport_test
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+const (
+	radioA = 0x0a
+	radioB = 0x0b
+)
+
+func TestManagerAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		// nums are the node numbers of the radios the clients added in turn connect to.
+		nums       []uint32
+		wantErr    error
+		wantRadios []uint32
+	}{
+		{name: "two radios", nums: []uint32{radioA, radioB}, wantRadios: []uint32{radioA, radioB}},
+		{name: "same radio twice", nums: []uint32{radioA, radioA}, wantErr: transport.ErrDuplicateRadio, wantRadios: []uint32{radioA}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManager(t)
+			radios := map[uint32]*fakeradio.Radio{}
+			var err error
+			for _, num := range tt.nums {
+				if radios[num] == nil {
+					radios[num] = newRadio(t, fakeradio.Config{MyInfo: &meshtastic.MyNodeInfo{MyNodeNum: num}})
+				}
+				_, err = m.Add(testContext(t), newClient(t, radios[num]))
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("last Add = %v, want %v", err, tt.wantErr)
+			}
+			if got := m.Radios(); !slices.Equal(got, tt.wantRadios) {
+				t.Errorf("Radios = %v, want %v", got, tt.wantRadios)
+			}
+		})
+	}
+}
+
+func TestManagerRemove(t *testing.T) {
+	tests := []struct {
+		name       string
+		remove     uint32
+		wantErr    error
+		wantRadios []uint32
+	}{
+		{name: "added radio", remove: radioA, wantRadios: []uint32{radioB}},
+		{name: "unknown radio", remove: 0x0c, wantErr: transport.ErrUnknownRadio, wantRadios: []uint32{radioA, radioB}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManager(t)
+			clients := map[uint32]*transport.Client{}
+			for _, num := range []uint32{radioA, radioB} {
+				clients[num] = newClient(t, newRadio(t, fakeradio.Config{MyInfo: &meshtastic.MyNodeInfo{MyNodeNum: num}}))
+				if _, err := m.Add(testContext(t), clients[num]); err != nil {
+					t.Fatalf("Add %s: %v", transport.NodeID(num), err)
+				}
+			}
+			if err := m.Remove(tt.remove); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Remove = %v, want %v", err, tt.wantErr)
+			}
+			if got := m.Radios(); !slices.Equal(got, tt.wantRadios) {
+				t.Errorf("Radios = %v, want %v", got, tt.wantRadios)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if _, err := m.Radio(tt.remove); !errors.Is(err, transport.ErrUnknownRadio) {
+				t.Errorf("Radio of the removed radio = %v, want ErrUnknownRadio", err)
+			}
+			if err := clients[tt.remove].SendPacket(testContext(t), &meshtastic.MeshPacket{To: 7}); err == nil {
+				t.Error("SendPacket through the removed radio's client succeeded, want it closed")
+			}
+		})
+	}
+}
+
+func TestManagerRejectedClient(t *testing.T) {
+	m := newManager(t)
+	var received atomic.Int32
+	m.Events.RegisterHandler(transport.EventMeshPacketReceived, func(transport.Event) { received.Add(1) })
+	radio := newRadio(t, fakeradio.Config{MyInfo: &meshtastic.MyNodeInfo{MyNodeNum: radioA}})
+	if _, err := m.Add(testContext(t), newClient(t, radio)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	rejected := newClient(t, radio)
+	if _, err := m.Add(testContext(t), rejected); !errors.Is(err, transport.ErrDuplicateRadio) {
+		t.Fatalf("Add of the same radio = %v, want ErrDuplicateRadio", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The rejected client is still connected and receives the packet, but does not hand it to the manager.
+	got := make(chan struct{}, 1)
+	rejected.Events.RegisterHandler(transport.EventMeshPacketReceived, func(transport.Event) { got <- struct{}{} })
+	radio.Inject(&meshtastic.MeshPacket{From: 7, Id: 1})
+	waitFor(t, got, "the rejected client to receive the packet")
+	rejected.Events.Wait()
+	m.Events.Wait()
+	if n := received.Load(); n != 0 {
+		t.Errorf("manager received %d packets through the rejected client, want 0", n)
+	}
+}
+
+func TestManagerReceive(t *testing.T) {
+	tests := []struct {
+		name string
+		// via are the radios the packet is injected into.
+		via []uint32
+		// wantRadio is the radio the packet is labelled with; zero accepts any of via.
+		wantRadio uint32
+	}{
+		{name: "first radio", via: []uint32{radioA}, wantRadio: radioA},
+		{name: "second radio", via: []uint32{radioB}, wantRadio: radioB},
+		{name: "both radios", via: []uint32{radioA, radioB}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManager(t)
+			events := make(chan transport.RadioPacket, 4)
+			m.Events.RegisterHandler(transport.EventMeshPacketReceived, func(event transport.Event) {
+				events <- event.Data.(transport.RadioPacket)
+			})
+			radios := map[uint32]*fakeradio.Radio{}
+			clients := map[uint32]*transport.Client{}
+			for _, num := range []uint32{radioA, radioB} {
+				radios[num] = newRadio(t, fakeradio.Config{MyInfo: &meshtastic.MyNodeInfo{MyNodeNum: num}})
+				clients[num] = newClient(t, radios[num])
+				if _, err := m.Add(testContext(t), clients[num]); err != nil {
+					t.Fatalf("Add %s: %v", transport.NodeID(num), err)
+				}
+			}
+
+			heard := make(chan struct{}, len(tt.via))
+			for _, num := range tt.via {
+				clients[num].Events.RegisterHandler(transport.EventMeshPacketReceived, func(transport.Event) {
+					heard <- struct{}{}
+				})
+				radios[num].Inject(&meshtastic.MeshPacket{From: 7, Id: 1})
+			}
+			for range tt.via {
+				waitFor(t, heard, "the radios to receive the packet")
+			}
+			for _, num := range tt.via {
+				clients[num].Events.Wait()
+			}
+			m.Events.Wait()
+
+			if len(events) != 1 {
+				t.Fatalf("manager passed the packet on %d times, want once", len(events))
+			}
+			got := <-events
+			if !slices.Contains(tt.via, got.Radio) || tt.wantRadio != 0 && got.Radio != tt.wantRadio {
+				t.Errorf("packet labelled with radio %s, want one of %v", transport.NodeID(got.Radio), tt.via)
+			}
+		})
+	}
+}
+
+// newManager creates a manager which is closed and waited for when the test ends.
+func newManager(t *testing.T) *transport.Manager {
+	t.Helper()
+	m := transport.NewManager()
+	t.Cleanup(func() {
+		_ = m.Close()
+		m.Wait()
+	})
+	return m
+}
@@ -0,0 +1,330 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrDropped is returned by a send when an outbound middleware dropped the message.
+var ErrDropped = errors.New("message dropped by middleware")
+
+// InboundFunc processes a message received from the radio.
+type InboundFunc func(ctx context.Context, msg *meshtastic.FromRadio) error
+
+// OutboundFunc processes a message on its way to the radio.
+type OutboundFunc func(ctx context.Context, msg *meshtastic.ToRadio) error
+
+// Middleware wraps the inbound and outbound message pipelines of a Client.
+// A middleware may inspect or modify the message, annotate it with Annotate, pass it on by calling next,
+// or drop it by returning without calling next. Outbound middlewares that drop a message should return ErrDropped.
+type Middleware interface {
+	Inbound(next InboundFunc) InboundFunc
+	Outbound(next OutboundFunc) OutboundFunc
+}
+
+// MiddlewareFuncs adapts a pair of functions to the Middleware interface. A nil function passes messages through.
+type MiddlewareFuncs struct {
+	In  func(next InboundFunc) InboundFunc
+	Out func(next OutboundFunc) OutboundFunc
+}
+
+// Inbound implements Middleware.
+func (m MiddlewareFuncs) Inbound(next InboundFunc) InboundFunc {
+	if m.In == nil {
+		return next
+	}
+	return m.In(next)
+}
+
+// Outbound implements Middleware.
+func (m MiddlewareFuncs) Outbound(next OutboundFunc) OutboundFunc {
+	if m.Out == nil {
+		return next
+	}
+	return m.Out(next)
+}
+
+// Annotations holds values middlewares attached to a message while it passes through the pipeline.
+type Annotations map[string]any
+
+type annotationsKey struct{}
+
+// withAnnotations returns a context carrying a fresh Annotations map.
+func withAnnotations(ctx context.Context) context.Context {
+	return context.WithValue(ctx, annotationsKey{}, Annotations{})
+}
+
+// Annotate attaches key and value to the message being processed with ctx. Annotations of a packet reach
+// subscriptions in PacketEvent.Annotations and event handlers in Event.Annotations. Handlers registered on
+// the HandlerRegistry only get the message and do not see them.
+func Annotate(ctx context.Context, key string, value any) {
+	if a, ok := ctx.Value(annotationsKey{}).(Annotations); ok {
+		a[key] = value
+	}
+}
+
+// AnnotationsFrom returns the annotations attached to the message being processed with ctx.
+func AnnotationsFrom(ctx context.Context) Annotations {
+	a, _ := ctx.Value(annotationsKey{}).(Annotations)
+	return a
+}
+
+// pipeline holds the composed middleware chains of a Client.
+type pipeline struct {
+	mu          sync.RWMutex
+	middlewares []Middleware
+	inbound     InboundFunc
+	outbound    OutboundFunc
+}
+
+// Use appends middlewares to the client's pipeline. The first middleware added sees inbound messages first
+// and outbound messages first. Use is meant to be called before Connect.
+func (c *Client) Use(middlewares ...Middleware) {
+	c.pipeline.mu.Lock()
+	defer c.pipeline.mu.Unlock()
+	c.pipeline.middlewares = append(c.pipeline.middlewares, middlewares...)
+
+	inbound := InboundFunc(func(ctx context.Context, msg *meshtastic.FromRadio) error {
+		c.handleFromRadio(ctx, msg)
+		return nil
+	})
+	outbound := OutboundFunc(func(_ context.Context, msg *meshtastic.ToRadio) error {
+		return c.conn().Write(msg)
+	})
+	for i := len(c.pipeline.middlewares) - 1; i >= 0; i-- {
+		inbound = c.pipeline.middlewares[i].Inbound(inbound)
+		outbound = c.pipeline.middlewares[i].Outbound(outbound)
+	}
+	c.pipeline.inbound, c.pipeline.outbound = inbound, outbound
+}
+
+// receive passes msg through the inbound middlewares to the handlers.
+func (c *Client) receive(msg *meshtastic.FromRadio) error {
+	c.pipeline.mu.RLock()
+	inbound := c.pipeline.inbound
+	c.pipeline.mu.RUnlock()
+	ctx := withAnnotations(c.ctx)
+	if inbound == nil {
+		c.handleFromRadio(ctx, msg)
+		return nil
+	}
+	return inbound(ctx, msg)
+}
+
+// write passes msg through the outbound middlewares to the radio.
+func (c *Client) write(ctx context.Context, msg *meshtastic.ToRadio) error {
+	c.pipeline.mu.RLock()
+	outbound := c.pipeline.outbound
+	c.pipeline.mu.RUnlock()
+	if outbound == nil {
+		return c.conn().Write(msg)
+	}
+	return outbound(withAnnotations(ctx), msg)
+}
+
+// LogMiddleware logs every message in both directions at debug level.
+func LogMiddleware(logger *slog.Logger) Middleware {
+	return MiddlewareFuncs{
+		In: func(next InboundFunc) InboundFunc {
+			return func(ctx context.Context, msg *meshtastic.FromRadio) error {
+				logger.Debug("from radio", "msg", msg)
+				return next(ctx, msg)
+			}
+		},
+		Out: func(next OutboundFunc) OutboundFunc {
+			return func(ctx context.Context, msg *meshtastic.ToRadio) error {
+				logger.Debug("to radio", "msg", msg)
+				return next(ctx, msg)
+			}
+		},
+	}
+}
+
+// FilterMiddleware drops inbound messages for which keep returns false. The messages of the config download
+// are always passed on, as Connect and the State depend on them.
+func FilterMiddleware(keep func(msg *meshtastic.FromRadio) bool) Middleware {
+	return MiddlewareFuncs{
+		In: func(next InboundFunc) InboundFunc {
+			return func(ctx context.Context, msg *meshtastic.FromRadio) error {
+				if !isConfigMessage(msg) && !keep(msg) {
+					return nil
+				}
+				return next(ctx, msg)
+			}
+		},
+	}
+}
+
+// isConfigMessage reports whether msg is one of the messages the radio sends while downloading its config.
+func isConfigMessage(msg *meshtastic.FromRadio) bool {
+	switch msg.GetPayloadVariant().(type) {
+	case *meshtastic.FromRadio_MyInfo, *meshtastic.FromRadio_Metadata, *meshtastic.FromRadio_NodeInfo,
+		*meshtastic.FromRadio_Channel, *meshtastic.FromRadio_Config, *meshtastic.FromRadio_ModuleConfig,
+		*meshtastic.FromRadio_ConfigCompleteId:
+		return true
+	}
+	return false
+}
+
+// DropOwnEchoes drops inbound packets sent by the local node, as reported in state.
+func DropOwnEchoes(state *State) Middleware {
+	return FilterMiddleware(func(msg *meshtastic.FromRadio) bool {
+		packet := msg.GetPacket()
+		if packet == nil {
+			return true
+		}
+		own := state.NodeInfo().GetMyNodeNum()
+		return own == 0 || packet.GetFrom() != own
+	})
+}
+
+// packetKey identifies a packet on the mesh.
+type packetKey struct {
+	from, id uint32
+}
+
+// DedupMiddleware drops inbound packets with a sender and packet ID already seen within window.
+// Packets without an ID are always passed on.
+func DedupMiddleware(window time.Duration) Middleware {
+	seen := newPacketDedup(window)
+	return FilterMiddleware(func(msg *meshtastic.FromRadio) bool {
+		packet := msg.GetPacket()
+		return packet == nil || seen.first(packet)
+	})
+}
+
+// packetDedup remembers the packets seen within a window.
+type packetDedup struct {
+	mu        sync.Mutex
+	window    time.Duration
+	seen      map[packetKey]time.Time
+	lastSweep time.Time
+}
+
+// newPacketDedup creates a packetDedup forgetting packets after window.
+func newPacketDedup(window time.Duration) *packetDedup {
+	return &packetDedup{window: window, seen: make(map[packetKey]time.Time), lastSweep: time.Now()}
+}
+
+// first reports whether packet is the first with its sender and packet ID within the window.
+// Packets without an ID are always reported as first.
+func (d *packetDedup) first(packet *meshtastic.MeshPacket) bool {
+	if packet.GetId() == 0 {
+		return true
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.lastSweep) > d.window {
+		for k, t := range d.seen {
+			if now.Sub(t) > d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.lastSweep = now
+	}
+	key := packetKey{from: packet.GetFrom(), id: packet.GetId()}
+	if t, ok := d.seen[key]; ok && now.Sub(t) <= d.window {
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
+
+// Metrics counts messages passing through the pipeline, by direction and payload variant.
+type Metrics struct {
+	// Link, when set, supplies the link health counters included in Snapshot, usually Client.LinkStats.
+	Link func() LinkStats
+
+	mu       sync.Mutex
+	inbound  map[string]uint64
+	outbound map[string]uint64
+}
+
+// MetricsSnapshot holds the counters of a Metrics at one point in time.
+type MetricsSnapshot struct {
+	// Inbound and Outbound hold the number of messages seen per payload variant.
+	Inbound  map[string]uint64
+	Outbound map[string]uint64
+	// Link holds the link health counters, zero unless Metrics.Link is set.
+	Link LinkStats
+}
+
+// NewMetrics creates an empty Metrics. Add it to a client with Use.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		inbound:  make(map[string]uint64),
+		outbound: make(map[string]uint64),
+	}
+}
+
+// variantName returns the name of the payload variant set in msg.
+func variantName(msg proto.Message) string {
+	m := msg.ProtoReflect()
+	oneof := m.Descriptor().Oneofs().ByName("payload_variant")
+	if oneof == nil {
+		return "unknown"
+	}
+	if field := m.WhichOneof(oneof); field != nil {
+		return string(field.Name())
+	}
+	return "unknown"
+}
+
+// Inbound implements Middleware.
+func (m *Metrics) Inbound(next InboundFunc) InboundFunc {
+	return func(ctx context.Context, msg *meshtastic.FromRadio) error {
+		m.mu.Lock()
+		m.inbound[variantName(msg)]++
+		m.mu.Unlock()
+		return next(ctx, msg)
+	}
+}
+
+// Outbound implements Middleware.
+func (m *Metrics) Outbound(next OutboundFunc) OutboundFunc {
+	return func(ctx context.Context, msg *meshtastic.ToRadio) error {
+		m.mu.Lock()
+		m.outbound[variantName(msg)]++
+		m.mu.Unlock()
+		return next(ctx, msg)
+	}
+}
+
+// Inbounds returns the number of inbound messages seen per payload variant.
+func (m *Metrics) Inbounds() map[string]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]uint64, len(m.inbound))
+	for k, v := range m.inbound {
+		counts[k] = v
+	}
+	return counts
+}
+
+// Outbounds returns the number of outbound messages seen per payload variant.
+func (m *Metrics) Outbounds() map[string]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]uint64, len(m.outbound))
+	for k, v := range m.outbound {
+		counts[k] = v
+	}
+	return counts
+}
+
+// Snapshot returns all counters of m.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	snap := MetricsSnapshot{Inbound: m.Inbounds(), Outbound: m.Outbounds()}
+	if m.Link != nil {
+		snap.Link = m.Link()
+	}
+	return snap
+}
@@ -0,0 +1,139 @@
+package transport_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+func TestFilterMiddleware(t *testing.T) {
+	tests := []struct {
+		name string
+		keep func(msg *meshtastic.FromRadio) bool
+		want []uint32 // IDs of the injected packets which reach the handlers
+	}{
+		{name: "keep everything", keep: func(*meshtastic.FromRadio) bool { return true }, want: []uint32{1, 2}},
+		{name: "keep nothing", keep: func(*meshtastic.FromRadio) bool { return false }},
+		{
+			name: "keep node 7",
+			keep: func(msg *meshtastic.FromRadio) bool { return msg.GetPacket().GetFrom() == 7 },
+			want: []uint32{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{})
+			c := newClient(t, radio)
+			c.Use(transport.FilterMiddleware(func(msg *meshtastic.FromRadio) bool {
+				// Packet 3 marks the end of the injected packets.
+				return msg.GetPacket().GetId() == 3 || tt.keep(msg)
+			}))
+			received := make(chan uint32, 4)
+			c.Events.RegisterHandler(transport.EventMeshPacketReceived, func(event transport.Event) {
+				received <- event.Data.(*meshtastic.MeshPacket).GetId()
+			}, transport.ExecPolicy{Mode: transport.ExecSequential})
+			// The config download passes the filter even when it drops everything else.
+			connect(t, c)
+			if c.State.NodeInfo().GetMyNodeNum() != radio.NodeNum() {
+				t.Fatalf("MyNodeNum = %d, want %d", c.State.NodeInfo().GetMyNodeNum(), radio.NodeNum())
+			}
+
+			radio.Inject(&meshtastic.MeshPacket{From: 7, Id: 1})
+			radio.Inject(&meshtastic.MeshPacket{From: 8, Id: 2})
+			radio.Inject(&meshtastic.MeshPacket{From: 9, Id: 3})
+			var got []uint32
+			for id := waitFor(t, received, "a packet"); id != 3; id = waitFor(t, received, "a packet") {
+				got = append(got, id)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("received %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("received %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	radio := newRadio(t, fakeradio.Config{})
+	c := newClient(t, radio)
+	c.Use(transport.MiddlewareFuncs{
+		In: func(next transport.InboundFunc) transport.InboundFunc {
+			return func(ctx context.Context, msg *meshtastic.FromRadio) error {
+				if msg.GetPacket() != nil {
+					transport.Annotate(ctx, "seen", msg.GetPacket().GetId())
+				}
+				return next(ctx, msg)
+			}
+		},
+	})
+	events := make(chan transport.Event, 1)
+	c.Events.RegisterHandler(transport.EventMeshPacketReceived, func(event transport.Event) {
+		events <- event
+	})
+	connect(t, c)
+	sub := c.Subscribe(testContext(t), transport.PacketFilter{})
+
+	radio.Inject(&meshtastic.MeshPacket{From: 7, Id: 42})
+	if got := waitFor(t, sub, "the subscription").Annotations["seen"]; got != uint32(42) {
+		t.Errorf("PacketEvent annotation = %v, want 42", got)
+	}
+	if got := waitFor(t, events, "the event").Annotations["seen"]; got != uint32(42) {
+		t.Errorf("Event annotation = %v, want 42", got)
+	}
+}
+
+func TestMetricsSnapshot(t *testing.T) {
+	tests := []struct {
+		name     string
+		withLink bool
+	}{
+		{name: "without link"},
+		{name: "with link", withLink: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{})
+			c := newClient(t, radio)
+			metrics := transport.NewMetrics()
+			if tt.withLink {
+				metrics.Link = c.LinkStats
+			}
+			c.Use(metrics)
+			connect(t, c)
+			if _, err := c.SendText(testContext(t), transport.BroadcastAddr, 0, "hi"); err != nil {
+				t.Fatalf("SendText: %v", err)
+			}
+
+			snap := metrics.Snapshot()
+			for variant, want := range map[string]uint64{"my_info": 1, "config_complete_id": 1} {
+				if got := snap.Inbound[variant]; got != want {
+					t.Errorf("Inbound[%s] = %d, want %d", variant, got, want)
+				}
+			}
+			for variant, want := range map[string]uint64{"want_config_id": 1, "packet": 1} {
+				if got := snap.Outbound[variant]; got != want {
+					t.Errorf("Outbound[%s] = %d, want %d", variant, got, want)
+				}
+			}
+			if !tt.withLink {
+				if snap.Link != (transport.LinkStats{}) {
+					t.Errorf("Link = %+v, want zero", snap.Link)
+				}
+				return
+			}
+			if snap.Link.FramesOut < 2 || snap.Link.FramesIn == 0 || snap.Link.BytesIn == 0 {
+				t.Errorf("Link = %+v, want the frames of the config download and the text", snap.Link)
+			}
+			if snap.Link.DecodeErrors != 0 || snap.Link.WriteErrors != 0 {
+				t.Errorf("Link = %+v, want no errors", snap.Link)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package transport
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Node is an entry of the NodeDB.
+type Node struct {
+	// Info holds what is known about the node, in the form the radio reports it during the config download.
+	Info *meshtastic.NodeInfo
+	// RSSI is the signal strength of the last packet received directly from the node. NodeInfo has no field for it.
+	// Relayed packets, and packets from firmware which does not report the hop count, leave it unchanged.
+	RSSI int32
+}
+
+// ID returns the node ID in the "!hex" form used by the firmware.
+func (n *Node) ID() string {
+	return NodeID(n.Info.GetNum())
+}
+
+// clone returns a deep copy of n.
+func (n *Node) clone() *Node {
+	return &Node{Info: proto.Clone(n.Info).(*meshtastic.NodeInfo), RSSI: n.RSSI}
+}
+
+// NodeID returns the "!hex" form of a node number, such as !0fa4e001.
+func NodeID(num uint32) string {
+	return "!" + strconv.FormatUint(uint64(0x100000000|uint64(num)), 16)[1:]
+}
+
+// NodeDB holds the nodes of the mesh keyed by node number. It is filled from the NodeInfos of the config download
+// and kept up to date from received packets. It is safe for concurrent use.
+type NodeDB struct {
+	mu    sync.RWMutex
+	nodes map[uint32]*Node
+	// changes counts the modifications, see State.Changes.
+	changes atomic.Uint64
+	// notify receives the change events, see State.SetNotify.
+	notify func(Event)
+}
+
+// Put stores node, replacing what is known about a node with the same number.
+func (db *NodeDB) Put(node *meshtastic.NodeInfo) {
+	db.mu.Lock()
+	if db.nodes == nil {
+		db.nodes = make(map[uint32]*Node)
+	}
+	var before *Node
+	entry, ok := db.nodes[node.GetNum()]
+	if ok {
+		before = entry.clone()
+	} else {
+		entry = &Node{}
+		db.nodes[node.GetNum()] = entry
+	}
+	entry.Info = proto.Clone(node).(*meshtastic.NodeInfo)
+	db.changes.Add(1)
+	after := entry.clone()
+	db.mu.Unlock()
+	db.emit(nodeEvents(before, after))
+}
+
+// Update merges what packet tells about its sender: the user of NODEINFO_APP packets, the position of
+// POSITION_APP packets, the device metrics of TELEMETRY_APP packets, and the time, signal and hop count
+// it was received with. A position only replaces the fields it carries. It returns a copy of the updated
+// node, or nil when the packet has no sender.
+func (db *NodeDB) Update(packet *meshtastic.MeshPacket) *Node {
+	if packet.GetFrom() == 0 {
+		return nil
+	}
+	var payload proto.Message
+	if data := packet.GetDecoded(); data != nil {
+		// A payload that does not decode still tells us the node was heard.
+		payload, _ = DecodePayload(data)
+	}
+
+	db.mu.Lock()
+	if db.nodes == nil {
+		db.nodes = make(map[uint32]*Node)
+	}
+	var before *Node
+	entry, ok := db.nodes[packet.GetFrom()]
+	if ok {
+		before = entry.clone()
+	} else {
+		entry = &Node{Info: &meshtastic.NodeInfo{Num: packet.GetFrom()}}
+		db.nodes[packet.GetFrom()] = entry
+	}
+	info := entry.Info
+
+	switch p := payload.(type) {
+	case *meshtastic.User:
+		info.User = p
+	case *meshtastic.Position:
+		if info.Position == nil {
+			info.Position = p
+		} else {
+			proto.Merge(info.Position, p)
+		}
+	case *meshtastic.Telemetry:
+		if metrics := p.GetDeviceMetrics(); metrics != nil {
+			info.DeviceMetrics = metrics
+		}
+	}
+
+	info.LastHeard = packet.GetRxTime()
+	if info.LastHeard == 0 {
+		info.LastHeard = uint32(time.Now().Unix())
+	}
+	info.ViaMqtt = packet.GetViaMqtt()
+	// Firmware before 2.3 does not set hop_start, so the hop count is unknown.
+	start := packet.GetHopStart()
+	if start != 0 && start >= packet.GetHopLimit() {
+		info.HopsAway = start - packet.GetHopLimit()
+	}
+	if packet.GetRxSnr() != 0 || packet.GetRxRssi() != 0 {
+		info.Snr = packet.GetRxSnr()
+		// The signal of a relayed packet is that of the last relay, not of the node.
+		if start != 0 && start == packet.GetHopLimit() {
+			entry.RSSI = packet.GetRxRssi()
+		}
+	}
+	db.changes.Add(1)
+	after := entry.clone()
+	db.mu.Unlock()
+	db.emit(nodeEvents(before, after))
+	return after.clone()
+}
+
+// Get returns a copy of the node with number num.
+func (db *NodeDB) Get(num uint32) (*Node, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	entry, ok := db.nodes[num]
+	if !ok {
+		return nil, false
+	}
+	return entry.clone(), true
+}
+
+// Lookup returns a copy of the node named by id, which is a node number, a "!hex" node ID,
+// or the short or long name of the node. Names are compared ignoring case; when several nodes
+// share a name the one with the lowest number is returned.
+func (db *NodeDB) Lookup(id string) (*Node, bool) {
+	if num, err := ParseNodeID(id); err == nil {
+		if node, ok := db.Get(num); ok {
+			return node, true
+		}
+	}
+	for _, node := range db.All() {
+		user := node.Info.GetUser()
+		if strings.EqualFold(user.GetShortName(), id) || strings.EqualFold(user.GetLongName(), id) {
+			return node, true
+		}
+	}
+	return nil, false
+}
+
+// ParseNodeID parses a decimal node number or a "!hex" node ID, the form NodeID returns.
+func ParseNodeID(id string) (uint32, error) {
+	digits, base := id, 10
+	if strings.HasPrefix(id, "!") {
+		digits, base = id[1:], 16
+	}
+	num, err := strconv.ParseUint(digits, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid node ID %q", id)
+	}
+	return uint32(num), nil
+}
+
+// All returns copies of all nodes ordered by node number.
+func (db *NodeDB) All() []*Node {
+	db.mu.RLock()
+	nodes := make([]*Node, 0, len(db.nodes))
+	for _, entry := range db.nodes {
+		nodes = append(nodes, entry.clone())
+	}
+	db.mu.RUnlock()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Info.GetNum() < nodes[j].Info.GetNum() })
+	return nodes
+}
+
+// Len returns the number of nodes.
+func (db *NodeDB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.nodes)
+}
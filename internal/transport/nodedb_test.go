@@ -0,0 +1,118 @@
+package transport_test
+
+import (
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNodeDBSignal(t *testing.T) {
+	tests := []struct {
+		name     string
+		hopStart uint32
+		hopLimit uint32
+		wantRSSI int32
+		wantHops uint32
+		wantSNR  float32
+	}{
+		{name: "direct", hopStart: 3, hopLimit: 3, wantRSSI: -80, wantSNR: 6},
+		{name: "relayed", hopStart: 3, hopLimit: 1, wantRSSI: -50, wantHops: 2, wantSNR: 6},
+		{name: "no hop count", wantRSSI: -50, wantSNR: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var db transport.NodeDB
+			// A direct packet sets the RSSI the later packet has to keep or replace.
+			db.Update(&meshtastic.MeshPacket{From: 7, HopStart: 3, HopLimit: 3, RxRssi: -50, RxSnr: 1})
+			node := db.Update(&meshtastic.MeshPacket{From: 7, HopStart: tt.hopStart, HopLimit: tt.hopLimit, RxRssi: -80, RxSnr: 6})
+			if node.RSSI != tt.wantRSSI {
+				t.Errorf("RSSI = %d, want %d", node.RSSI, tt.wantRSSI)
+			}
+			if node.Info.GetHopsAway() != tt.wantHops {
+				t.Errorf("HopsAway = %d, want %d", node.Info.GetHopsAway(), tt.wantHops)
+			}
+			if node.Info.GetSnr() != tt.wantSNR {
+				t.Errorf("Snr = %v, want %v", node.Info.GetSnr(), tt.wantSNR)
+			}
+		})
+	}
+}
+
+func TestNodeDBPosition(t *testing.T) {
+	tests := []struct {
+		name   string
+		update *meshtastic.Position
+		want   *meshtastic.Position
+	}{
+		{
+			name:   "full fix",
+			update: &meshtastic.Position{LatitudeI: proto.Int32(2), LongitudeI: proto.Int32(3), Altitude: proto.Int32(4)},
+			want:   &meshtastic.Position{LatitudeI: proto.Int32(2), LongitudeI: proto.Int32(3), Altitude: proto.Int32(4)},
+		},
+		{
+			name:   "without altitude",
+			update: &meshtastic.Position{LatitudeI: proto.Int32(2), LongitudeI: proto.Int32(3)},
+			want:   &meshtastic.Position{LatitudeI: proto.Int32(2), LongitudeI: proto.Int32(3), Altitude: proto.Int32(100)},
+		},
+		{
+			name:   "altitude only",
+			update: &meshtastic.Position{Altitude: proto.Int32(4)},
+			want:   &meshtastic.Position{LatitudeI: proto.Int32(10), LongitudeI: proto.Int32(20), Altitude: proto.Int32(4)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var db transport.NodeDB
+			db.Update(positionPacket(t, 7, &meshtastic.Position{LatitudeI: proto.Int32(10), LongitudeI: proto.Int32(20), Altitude: proto.Int32(100)}))
+			node := db.Update(positionPacket(t, 7, tt.update))
+			if !proto.Equal(node.Info.GetPosition(), tt.want) {
+				t.Errorf("Position = %v, want %v", node.Info.GetPosition(), tt.want)
+			}
+		})
+	}
+}
+
+// positionPacket returns a POSITION_APP packet from the node from carrying position.
+func positionPacket(t *testing.T, from uint32, position *meshtastic.Position) *meshtastic.MeshPacket {
+	t.Helper()
+	payload, err := proto.Marshal(position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &meshtastic.MeshPacket{From: from, PayloadVariant: &meshtastic.MeshPacket_Decoded{Decoded: &meshtastic.Data{
+		Portnum: meshtastic.PortNum_POSITION_APP,
+		Payload: payload,
+	}}}
+}
+
+func TestParseNodeID(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    uint32
+		wantErr bool
+	}{
+		{id: "!0fa4e001", want: 0x0fa4e001},
+		{id: "!FA4E001", want: 0x0fa4e001},
+		{id: "262463489", want: 0x0fa4e001},
+		{id: "!ffffffff", want: transport.BroadcastAddr},
+		{id: "", wantErr: true},
+		{id: "!", wantErr: true},
+		{id: "0fa4e001", wantErr: true},
+		{id: "!100000000", wantErr: true},
+		{id: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, err := transport.ParseNodeID(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNodeID(%q) = %v, want an error: %v", tt.id, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseNodeID(%q) = %#x, want %#x", tt.id, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"fmt"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// payloadTypes maps the ports carrying a protobuf payload to the message they carry.
+var payloadTypes = map[meshtastic.PortNum]proto.Message{
+	meshtastic.PortNum_REMOTE_HARDWARE_APP: (*meshtastic.HardwareMessage)(nil),
+	meshtastic.PortNum_POSITION_APP:        (*meshtastic.Position)(nil),
+	meshtastic.PortNum_NODEINFO_APP:        (*meshtastic.User)(nil),
+	meshtastic.PortNum_ROUTING_APP:         (*meshtastic.Routing)(nil),
+	meshtastic.PortNum_ADMIN_APP:           (*meshtastic.AdminMessage)(nil),
+	meshtastic.PortNum_WAYPOINT_APP:        (*meshtastic.Waypoint)(nil),
+	meshtastic.PortNum_PAXCOUNTER_APP:      (*meshtastic.Paxcount)(nil),
+	meshtastic.PortNum_STORE_FORWARD_APP:   (*meshtastic.StoreAndForward)(nil),
+	meshtastic.PortNum_TELEMETRY_APP:       (*meshtastic.Telemetry)(nil),
+	meshtastic.PortNum_TRACEROUTE_APP:      (*meshtastic.RouteDiscovery)(nil),
+	meshtastic.PortNum_NEIGHBORINFO_APP:    (*meshtastic.NeighborInfo)(nil),
+	meshtastic.PortNum_ATAK_PLUGIN:         (*meshtastic.TAKPacket)(nil),
+	meshtastic.PortNum_MAP_REPORT_APP:      (*meshtastic.MapReport)(nil),
+	meshtastic.PortNum_POWERSTRESS_APP:     (*meshtastic.PowerStressMessage)(nil),
+}
+
+// payloadPorts is the reverse of payloadTypes, keyed by message name.
+var payloadPorts = func() map[protoreflect.FullName]meshtastic.PortNum {
+	ports := make(map[protoreflect.FullName]meshtastic.PortNum, len(payloadTypes))
+	for port, msg := range payloadTypes {
+		ports[proto.MessageName(msg)] = port
+	}
+	return ports
+}()
+
+// PayloadPort returns the port carrying payloads of the same type as msg.
+func PayloadPort(msg proto.Message) (meshtastic.PortNum, bool) {
+	port, ok := payloadPorts[proto.MessageName(msg)]
+	return port, ok
+}
+
+// DecodePayload unmarshals the payload of data into the message its port carries.
+// It returns nil and no error for ports without a protobuf payload, such as text messages.
+func DecodePayload(data *meshtastic.Data) (proto.Message, error) {
+	kind, ok := payloadTypes[data.GetPortnum()]
+	if !ok {
+		return nil, nil
+	}
+	msg := kind.ProtoReflect().New().Interface()
+	if err := proto.Unmarshal(data.GetPayload(), msg); err != nil {
+		return nil, fmt.Errorf("decoding %s payload: %w", data.GetPortnum(), err)
+	}
+	return msg, nil
+}
+
+// On registers fn for every message of type T received from the radio, such as *generated.MeshPacket,
+// *generated.QueueStatus or *generated.LogRecord. Payload types carried inside a MeshPacket, such as
+// *generated.Position, are registered with OnPayload instead. An optional ExecPolicy controls how calls are scheduled.
+func On[T proto.Message](c *Client, fn func(T), policy ...ExecPolicy) {
+	var kind T
+	c.handlers.RegisterHandler(kind, func(msg proto.Message) {
+		if m, ok := msg.(T); ok {
+			fn(m)
+		}
+	}, policy...)
+}
+
+// OnPort registers fn for every decoded packet on port, with the payload unmarshalled into T.
+func OnPort[T proto.Message](c *Client, port meshtastic.PortNum, fn func(packet *meshtastic.MeshPacket, payload T), policy ...ExecPolicy) {
+	var kind T
+	c.handlers.RegisterPortHandler(port, kind, func(packet *meshtastic.MeshPacket, payload proto.Message) {
+		if m, ok := payload.(T); ok {
+			fn(packet, m)
+		}
+	}, policy...)
+}
+
+// OnPayload registers fn for every decoded packet whose port carries T, e.g. POSITION_APP for *generated.Position.
+// It panics if T is not carried by any known port; use OnPort for those.
+func OnPayload[T proto.Message](c *Client, fn func(packet *meshtastic.MeshPacket, payload T), policy ...ExecPolicy) {
+	var kind T
+	port, ok := PayloadPort(kind)
+	if !ok {
+		panic(fmt.Sprintf("transport: no port carries %s", proto.MessageName(kind)))
+	}
+	OnPort(c, port, fn, policy...)
+}
+
+// OnText registers fn for every text message.
+func OnText(c *Client, fn func(packet *meshtastic.MeshPacket, text string), policy ...ExecPolicy) {
+	c.handlers.RegisterPortHandler(meshtastic.PortNum_TEXT_MESSAGE_APP, nil, func(packet *meshtastic.MeshPacket, _ proto.Message) {
+		fn(packet, string(packet.GetDecoded().GetPayload()))
+	}, policy...)
+}
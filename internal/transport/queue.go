@@ -0,0 +1,312 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+const (
+	// DefaultQueueStatusTimeout is how long the send queue waits for the radio to report the result of a packet.
+	// Firmware that does not send QueueStatus is handled by assuming success once it expires. After the first
+	// such timeout on a radio which never sent a QueueStatus, packets only wait queueStatuslessWait.
+	DefaultQueueStatusTimeout = 2 * time.Second
+	// DefaultQueueRetries is how often a packet the radio refused is sent again before giving up.
+	DefaultQueueRetries = 3
+	// queueFullPoll is how long the send queue waits for the radio to free a slot before trying anyway.
+	queueFullPoll = time.Second
+	// queueRetryDelay is the pause before re-sending a packet the radio refused.
+	queueRetryDelay = 250 * time.Millisecond
+	// queueStatuslessWait paces the packets for a radio which turned out not to send QueueStatus.
+	queueStatuslessWait = 50 * time.Millisecond
+)
+
+// QueueError is returned when the radio refused a packet on every attempt.
+type QueueError struct {
+	// Res is the firmware error code from the last QueueStatus.
+	Res int32
+}
+
+// Error implements the error interface.
+func (e *QueueError) Error() string {
+	return fmt.Sprintf("radio refused packet: error code %d", e.Res)
+}
+
+// QueueStats is a snapshot of the outbound send queue.
+type QueueStats struct {
+	// Depth is the number of packets waiting to be handed to the radio, including the one in flight.
+	Depth int
+	// Free and Maxlen are the radio's TX queue slots as last reported by QueueStatus.
+	Free   uint32
+	Maxlen uint32
+	// Sent is the number of packets the radio accepted.
+	Sent uint64
+	// Retried is the number of re-sends after the radio refused a packet.
+	Retried uint64
+	// Failed is the number of packets given up on.
+	Failed uint64
+	// LastWait is how long the most recently accepted packet spent in the queue.
+	LastWait time.Duration
+	// AvgWait is the average time accepted packets spent in the queue.
+	AvgWait time.Duration
+}
+
+// queuedPacket is a packet waiting in the send queue.
+type queuedPacket struct {
+	packet   *meshtastic.MeshPacket
+	enqueued time.Time
+	result   chan error
+}
+
+// sendQueue hands packets to the radio one at a time, honoring the free slots the radio reports.
+type sendQueue struct {
+	mu       sync.Mutex
+	items    []*queuedPacket
+	free     uint32
+	maxlen   uint32
+	known    bool // whether free and maxlen have been reported yet
+	inFlight uint32
+	// reported is set once the radio sent a QueueStatus, and statusless once a packet timed out before that.
+	reported   bool
+	statusless bool
+	statuses   chan *meshtastic.QueueStatus
+	wake       chan struct{}
+
+	sent, retried, failed uint64
+	lastWait, totalWait   time.Duration
+}
+
+// newSendQueue creates an empty send queue.
+func newSendQueue() *sendQueue {
+	return &sendQueue{
+		statuses: make(chan *meshtastic.QueueStatus, 1),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// signal wakes up the queue worker.
+func (q *sendQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// push appends packet to the queue and returns the channel its result is delivered on.
+func (q *sendQueue) push(packet *meshtastic.MeshPacket) chan error {
+	item := &queuedPacket{packet: packet, enqueued: time.Now(), result: make(chan error, 1)}
+	q.mu.Lock()
+	q.items = append(q.items, item)
+	q.mu.Unlock()
+	q.signal()
+	return item.result
+}
+
+// status records a QueueStatus from the radio.
+func (q *sendQueue) status(qs *meshtastic.QueueStatus) {
+	q.mu.Lock()
+	q.free, q.maxlen, q.known = qs.GetFree(), qs.GetMaxlen(), true
+	q.reported, q.statusless = true, false
+	forInFlight := q.inFlight != 0 && qs.GetMeshPacketId() == q.inFlight
+	q.mu.Unlock()
+	if forInFlight {
+		select {
+		case q.statuses <- qs:
+		default:
+		}
+	}
+	q.signal()
+}
+
+// stats returns a snapshot of the queue.
+func (q *sendQueue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := QueueStats{
+		Depth:    len(q.items),
+		Free:     q.free,
+		Maxlen:   q.maxlen,
+		Sent:     q.sent,
+		Retried:  q.retried,
+		Failed:   q.failed,
+		LastWait: q.lastWait,
+	}
+	if q.sent > 0 {
+		stats.AvgWait = q.totalWait / time.Duration(q.sent)
+	}
+	return stats
+}
+
+// next blocks until there is a packet to send and the radio has room for it.
+// It returns nil once ctx is done.
+func (q *sendQueue) next(ctx context.Context) *queuedPacket {
+	for {
+		q.mu.Lock()
+		var item *queuedPacket
+		full := q.known && q.free == 0
+		if len(q.items) > 0 && !full {
+			item = q.items[0]
+		}
+		q.mu.Unlock()
+		if item != nil {
+			return item
+		}
+
+		var poll *time.Timer
+		var pollC <-chan time.Time
+		if full {
+			// The radio does not always report freed slots, so try again after a while.
+			poll = time.NewTimer(queueFullPoll)
+			pollC = poll.C
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-q.wake:
+		case <-pollC:
+			q.mu.Lock()
+			q.known = false
+			q.mu.Unlock()
+		}
+		if poll != nil {
+			poll.Stop()
+		}
+	}
+}
+
+// finish removes item from the head of the queue and delivers its result.
+func (q *sendQueue) finish(item *queuedPacket, err error) {
+	q.mu.Lock()
+	q.items = q.items[1:]
+	q.inFlight = 0
+	if err == nil {
+		wait := time.Since(item.enqueued)
+		q.sent++
+		q.lastWait = wait
+		q.totalWait += wait
+	} else {
+		q.failed++
+	}
+	q.mu.Unlock()
+	item.result <- err
+}
+
+// drain fails everything still queued with err.
+func (q *sendQueue) drain(err error) {
+	q.mu.Lock()
+	items := q.items
+	q.items = nil
+	q.mu.Unlock()
+	for _, item := range items {
+		item.result <- err
+	}
+}
+
+// sendLoop hands queued packets to the radio until the client is closed.
+func (c *Client) sendLoop() {
+	q := c.queue
+	defer q.drain(ErrClosed)
+	for {
+		item := q.next(c.ctx)
+		if item == nil {
+			return
+		}
+		q.finish(item, c.transmit(item.packet))
+	}
+}
+
+// transmit writes packet to the radio and waits for its QueueStatus, re-sending it when the radio refuses it.
+func (c *Client) transmit(packet *meshtastic.MeshPacket) error {
+	q := c.queue
+	msg := &meshtastic.ToRadio{
+		PayloadVariant: &meshtastic.ToRadio_Packet{Packet: packet},
+	}
+	var res int32
+	for attempt := 0; attempt <= DefaultQueueRetries; attempt++ {
+		if attempt > 0 {
+			q.mu.Lock()
+			q.retried++
+			q.mu.Unlock()
+			select {
+			case <-c.ctx.Done():
+				return ErrClosed
+			case <-time.After(queueRetryDelay):
+			}
+		}
+		// Drop a status left over from an earlier packet.
+		select {
+		case <-q.statuses:
+		default:
+		}
+		q.mu.Lock()
+		q.inFlight = packet.GetId()
+		if q.known && q.free > 0 {
+			q.free--
+		}
+		q.mu.Unlock()
+
+		if err := c.write(c.ctx, msg); err != nil {
+			return fmt.Errorf("writing packet: %w", err)
+		}
+
+		q.mu.Lock()
+		wait := c.QueueStatusTimeout
+		if q.statusless {
+			wait = min(wait, queueStatuslessWait)
+		}
+		q.mu.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return ErrClosed
+		case <-timer.C:
+			q.mu.Lock()
+			if !q.reported {
+				q.statusless = true
+			}
+			q.mu.Unlock()
+			return nil
+		case qs := <-q.statuses:
+			timer.Stop()
+			res = qs.GetRes()
+			if res == 0 {
+				return nil
+			}
+			c.log.Warn("radio refused packet", "id", packet.GetId(), "res", res, "attempt", attempt+1)
+		}
+	}
+	return &QueueError{Res: res}
+}
+
+// SendPacket queues packet for the radio and blocks until the radio accepted it, refused it for good or ctx is done.
+// Packets without an ID get a fresh one assigned. A packet whose ctx is done stays queued and is still sent.
+// Before Connect it returns ErrNotConnected, as nothing would send the packet.
+func (c *Client) SendPacket(ctx context.Context, packet *meshtastic.MeshPacket) error {
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	if !c.isStarted() {
+		return ErrNotConnected
+	}
+	if packet.GetId() == 0 {
+		packet.Id = c.NewPacketID()
+	}
+	result := c.queue.push(packet)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.ctx.Done():
+		return ErrClosed
+	case err := <-result:
+		return err
+	}
+}
+
+// QueueStats returns a snapshot of the outbound send queue.
+func (c *Client) QueueStats() QueueStats {
+	return c.queue.stats()
+}
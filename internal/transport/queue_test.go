@@ -0,0 +1,56 @@
+package transport_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+func TestSendBeforeConnect(t *testing.T) {
+	c := newClient(t, newRadio(t, fakeradio.Config{}))
+	if err := c.SendPacket(testContext(t), textPacket(7, false)); !errors.Is(err, transport.ErrNotConnected) {
+		t.Errorf("SendPacket = %v, want ErrNotConnected", err)
+	}
+	heartbeat := &meshtastic.ToRadio{PayloadVariant: &meshtastic.ToRadio_Heartbeat{Heartbeat: &meshtastic.Heartbeat{}}}
+	if err := c.SendToRadio(heartbeat); !errors.Is(err, transport.ErrNotConnected) {
+		t.Errorf("SendToRadio = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestSendQueue(t *testing.T) {
+	const packets = 5
+	const statusTimeout = 300 * time.Millisecond
+	tests := []struct {
+		name          string
+		noQueueStatus bool
+	}{
+		{name: "radio reports QueueStatus"},
+		{name: "radio without QueueStatus", noQueueStatus: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{NoQueueStatus: tt.noQueueStatus})
+			c := newClient(t, radio)
+			c.QueueStatusTimeout = statusTimeout
+			connect(t, c)
+
+			start := time.Now()
+			for i := 0; i < packets; i++ {
+				if err := c.SendPacket(testContext(t), textPacket(7, false)); err != nil {
+					t.Fatalf("SendPacket: %v", err)
+				}
+			}
+			// Only the first packet may wait the whole QueueStatusTimeout.
+			if elapsed := time.Since(start); elapsed > 2*statusTimeout {
+				t.Errorf("sending %d packets took %v", packets, elapsed)
+			}
+			if stats := c.QueueStats(); stats.Sent != packets || stats.Depth != 0 {
+				t.Errorf("QueueStats = %+v, want %d sent and none queued", stats, packets)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// DialFunc opens a fresh link to the radio.
+type DialFunc func(ctx context.Context) (*StreamConn, error)
+
+// StreamDialer returns a DialFunc which wraps the link returned by open, such as a serial port, in a StreamConn.
+// Every link it opens starts with the wake preamble, so a sleeping radio listens again after a reconnect.
+func StreamDialer(open func() (io.ReadWriteCloser, error)) DialFunc {
+	return func(_ context.Context) (*StreamConn, error) {
+		conn, err := open()
+		if err != nil {
+			return nil, err
+		}
+		sc, err := NewClientStreamConn(conn)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return sc, nil
+	}
+}
+
+// TCPDialer returns a DialFunc which connects to host with DialTCP.
+func TCPDialer(host string, opts TCPOptions) DialFunc {
+	return func(ctx context.Context) (*StreamConn, error) {
+		return DialTCP(ctx, host, opts)
+	}
+}
+
+// Backoff describes an exponential backoff between reconnect attempts.
+type Backoff struct {
+	// Initial is the delay before the first reconnect attempt.
+	Initial time.Duration
+	// Max caps the delay between attempts.
+	Max time.Duration
+	// Multiplier is applied to the delay after every failed attempt.
+	Multiplier float64
+}
+
+// DefaultBackoff is the Backoff used by new clients.
+var DefaultBackoff = Backoff{
+	Initial:    500 * time.Millisecond,
+	Max:        30 * time.Second,
+	Multiplier: 2,
+}
+
+// delay returns the delay to wait before the given attempt, starting at 1.
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempt && d < b.Max; i++ {
+		d = time.Duration(float64(d) * b.Multiplier)
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// reconnect replaces the dead link with a freshly dialed one, retrying with backoff until it succeeds,
+// and then requests the config again so the State gets rebuilt. It only returns an error when the
+// client is closed while reconnecting.
+func (c *Client) reconnect(cause error) error {
+	c.Events.Dispatch(Event{Type: EventDisconnected, Data: cause})
+
+	c.scMu.Lock()
+	c.log.Info("link lost", "link", c.sc.Stats())
+	if err := c.sc.Close(); err != nil {
+		c.log.Debug("closing dead link", "err", err)
+	}
+	c.scMu.Unlock()
+	c.State.reset()
+
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(c.Backoff.delay(attempt))
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return c.ctx.Err()
+		case <-timer.C:
+		}
+		c.log.Info("reconnecting to radio", "attempt", attempt)
+		sc, err := c.dial(c.ctx)
+		if err != nil {
+			c.log.Warn("reconnect failed", "attempt", attempt, "err", err)
+			continue
+		}
+		c.setConn(sc)
+		if c.ctx.Err() != nil {
+			// Close raced with the dial and has already shut the old link down.
+			_ = sc.Close()
+			return c.ctx.Err()
+		}
+		if err := c.sendGetConfig(); err != nil {
+			c.log.Warn("requesting config after reconnect", "attempt", attempt, "err", err)
+			_ = sc.Close()
+			continue
+		}
+		c.log.Info("reconnected to radio", "attempt", attempt)
+		c.Events.Dispatch(Event{Type: EventReconnected, Data: attempt})
+		return nil
+	}
+}
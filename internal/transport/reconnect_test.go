@@ -0,0 +1,49 @@
+package transport_test
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+)
+
+func TestStreamDialerWake(t *testing.T) {
+	radio := newRadio(t, fakeradio.Config{})
+	var wakes atomic.Int32
+	dial := transport.StreamDialer(func() (io.ReadWriteCloser, error) {
+		return &wakeCounter{ReadWriteCloser: radio.Pipe(), wakes: &wakes}, nil
+	})
+	c := transport.NewDialClient(dial, false)
+	c.Backoff = transport.Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2}
+	t.Cleanup(func() { _ = c.Close() })
+	reconnected := make(chan struct{}, 1)
+	c.Events.RegisterHandler(transport.EventReconnected, func(transport.Event) { reconnected <- struct{}{} })
+
+	connect(t, c)
+	if n := wakes.Load(); n != 1 {
+		t.Fatalf("%d wake preambles after Connect, want 1", n)
+	}
+	radio.DropLinks()
+	waitFor(t, reconnected, "the reconnect")
+	if n := wakes.Load(); n != 2 {
+		t.Errorf("%d wake preambles after the reconnect, want 2", n)
+	}
+}
+
+// wakeCounter counts the wake preambles written to the link. The link is a net.Pipe, so the radio has read
+// whatever a write returned for.
+type wakeCounter struct {
+	io.ReadWriteCloser
+	wakes *atomic.Int32
+}
+
+func (w *wakeCounter) Write(p []byte) (int, error) {
+	if bytes.Equal(p, bytes.Repeat([]byte{transport.Start2}, 32)) {
+		w.wakes.Add(1)
+	}
+	return w.ReadWriteCloser.Write(p)
+}
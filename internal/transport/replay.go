@@ -0,0 +1,343 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrReplayMismatch is returned by ReplayConn when a write does not match the recorded outbound frame.
+var ErrReplayMismatch = errors.New("write does not match capture")
+
+// ReplayOptions configures how a ReplayConn plays back a capture.
+type ReplayOptions struct {
+	// Speed scales the recorded gaps between inbound records: 1 keeps the original timing, 10 plays ten
+	// times faster. Zero or less delivers every record as soon as it is read.
+	Speed float64
+	// Lockstep holds back every inbound record until all outbound frames recorded before it have been
+	// written, so the replayed radio only answers requests it has actually received.
+	Lockstep bool
+	// CheckWrites makes every written frame be compared with the next recorded outbound frame.
+	// A mismatch or a write past the last recorded frame fails with ErrReplayMismatch. A want_config_id
+	// request matches a recorded one whatever nonce it carries.
+	CheckWrites bool
+	// MatchWrite compares a recorded outbound frame with a written one when CheckWrites is set.
+	// Defaults to bytes.Equal; replace it when frames carry values that change between runs, such as packet IDs.
+	MatchWrite func(want, got []byte) bool
+}
+
+// ReplayConn is an io.ReadWriteCloser which plays a capture back as if it were the radio. Reads return the
+// recorded inbound frames and debug output, framed for the stream protocol, and end with io.EOF once the
+// capture is exhausted. Writes are parsed into frames and optionally checked against the recorded outbound
+// frames. Wrap it with NewRadioStreamConn, or hand it to StreamDialer.
+//
+// The nonce of a config download changes from run to run, so the n-th recorded config_complete_id is
+// replaced by the nonce of the n-th want_config_id written, and held back until that request was written.
+type ReplayConn struct {
+	opts    ReplayOptions
+	records []CaptureRecord
+
+	mu sync.Mutex
+	// inNext and outNext are the indexes of the next inbound and outbound record to replay or expect.
+	inNext  int
+	outNext int
+	// pending holds the rest of the inbound record being read.
+	pending []byte
+	// wbuf collects written bytes until a whole frame has arrived.
+	wbuf []byte
+	// anchorWall and anchorRec tie the capture clock to the wall clock; inbound records are due relative to them.
+	anchorWall time.Time
+	anchorRec  time.Time
+	// nonces holds the want_config_id nonces written so far, completes the number of config_complete_id
+	// records delivered.
+	nonces    []uint32
+	completes int
+	// wrote is closed and replaced whenever a frame is written.
+	wrote  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// NewReplayConn reads all records of r and returns a ReplayConn playing them back.
+func NewReplayConn(r *CaptureReader, opts ReplayOptions) (*ReplayConn, error) {
+	var records []CaptureRecord
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	if opts.MatchWrite == nil {
+		opts.MatchWrite = bytes.Equal
+	}
+	c := &ReplayConn{
+		opts:    opts,
+		records: records,
+		wrote:   make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	c.inNext = c.nextIndex(0, false)
+	c.outNext = c.nextIndex(0, true)
+	return c, nil
+}
+
+// OpenReplay opens the capture file at path and returns a ReplayConn playing it back.
+func OpenReplay(path string, opts ReplayOptions) (*ReplayConn, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := NewCaptureReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayConn(r, opts)
+}
+
+// nextIndex returns the index of the first outbound record, or the first other record, at or after i.
+func (c *ReplayConn) nextIndex(i int, outbound bool) int {
+	for ; i < len(c.records); i++ {
+		if (c.records[i].Kind == CaptureOut) == outbound {
+			return i
+		}
+	}
+	return len(c.records)
+}
+
+// Read implements io.Reader. It blocks until the next inbound record is due.
+func (c *ReplayConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.pending) == 0 {
+		if err := c.closedErr(); err != nil {
+			return 0, err
+		}
+		if c.inNext >= len(c.records) {
+			return 0, io.EOF
+		}
+		if err := c.waitDue(); err != nil {
+			return 0, err
+		}
+		rec := c.records[c.inNext]
+		data := rec.Data
+		if rec.Kind == CaptureIn {
+			var err error
+			if data, err = c.liveConfigComplete(data); err != nil {
+				return 0, err
+			}
+		}
+		c.inNext = c.nextIndex(c.inNext+1, false)
+		c.anchorWall, c.anchorRec = time.Now(), rec.Time
+		if rec.Kind == CaptureDebug {
+			c.pending = append(c.pending[:0], data...)
+			continue
+		}
+		c.pending = binary.BigEndian.AppendUint16(append(c.pending[:0], Start1, Start2), uint16(len(data)))
+		c.pending = append(c.pending, data...)
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// waitDue blocks until the record at inNext may be delivered. It is called with c.mu held and
+// releases it while waiting.
+func (c *ReplayConn) waitDue() error {
+	for c.opts.Lockstep && c.outNext < c.inNext {
+		wrote := c.wrote
+		c.mu.Unlock()
+		select {
+		case <-wrote:
+		case <-c.closed:
+		}
+		c.mu.Lock()
+		if err := c.closedErr(); err != nil {
+			return err
+		}
+	}
+	if c.opts.Speed <= 0 || c.anchorWall.IsZero() {
+		return nil
+	}
+	gap := c.records[c.inNext].Time.Sub(c.anchorRec)
+	wait := time.Until(c.anchorWall.Add(time.Duration(float64(gap) / c.opts.Speed)))
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	c.mu.Unlock()
+	defer c.mu.Lock()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.closed:
+		return io.EOF
+	}
+}
+
+// liveConfigComplete returns frame, or when it is a config_complete_id the same message carrying the nonce
+// of the matching want_config_id written, waiting for that. It is called with c.mu held and releases it while waiting.
+func (c *ReplayConn) liveConfigComplete(frame []byte) ([]byte, error) {
+	msg := &meshtastic.FromRadio{}
+	if proto.Unmarshal(frame, msg) != nil {
+		return frame, nil
+	}
+	if _, ok := msg.GetPayloadVariant().(*meshtastic.FromRadio_ConfigCompleteId); !ok {
+		return frame, nil
+	}
+	for len(c.nonces) <= c.completes {
+		wrote := c.wrote
+		c.mu.Unlock()
+		select {
+		case <-wrote:
+		case <-c.closed:
+		}
+		c.mu.Lock()
+		if err := c.closedErr(); err != nil {
+			return nil, err
+		}
+	}
+	msg.PayloadVariant = &meshtastic.FromRadio_ConfigCompleteId{ConfigCompleteId: c.nonces[c.completes]}
+	c.completes++
+	return proto.Marshal(msg)
+}
+
+// wantConfigNonce returns the nonce of frame if it is a want_config_id request.
+func wantConfigNonce(frame []byte) (uint32, bool) {
+	msg := &meshtastic.ToRadio{}
+	if proto.Unmarshal(frame, msg) != nil {
+		return 0, false
+	}
+	if _, ok := msg.GetPayloadVariant().(*meshtastic.ToRadio_WantConfigId); !ok {
+		return 0, false
+	}
+	return msg.GetWantConfigId(), true
+}
+
+// Write implements io.Writer. Bytes outside of a frame, like the wake preamble, are ignored.
+func (c *ReplayConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.closedErr(); err != nil {
+		return 0, io.ErrClosedPipe
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.wbuf = append(c.wbuf, p...)
+	for {
+		frame, ok := c.nextWrittenFrame()
+		if !ok {
+			return len(p), nil
+		}
+		if err := c.expectWrite(frame); err != nil {
+			c.err = err
+			return len(p), err
+		}
+	}
+}
+
+// nextWrittenFrame takes the next complete frame off the write buffer.
+func (c *ReplayConn) nextWrittenFrame() ([]byte, bool) {
+	for {
+		i := bytes.IndexByte(c.wbuf, Start1)
+		if i < 0 {
+			c.wbuf = c.wbuf[:0]
+			return nil, false
+		}
+		c.wbuf = c.wbuf[i:]
+		if len(c.wbuf) < 4 {
+			return nil, false
+		}
+		length := int(binary.BigEndian.Uint16(c.wbuf[2:4]))
+		if c.wbuf[1] != Start2 || length > PacketMTU {
+			c.wbuf = c.wbuf[1:]
+			continue
+		}
+		if len(c.wbuf) < 4+length {
+			return nil, false
+		}
+		frame := bytes.Clone(c.wbuf[4 : 4+length])
+		c.wbuf = c.wbuf[4+length:]
+		return frame, true
+	}
+}
+
+// expectWrite advances past the next recorded outbound frame, checking frame against it if asked to.
+func (c *ReplayConn) expectWrite(frame []byte) error {
+	nonce, wantConfig := wantConfigNonce(frame)
+	if wantConfig {
+		c.nonces = append(c.nonces, nonce)
+	}
+	if c.outNext >= len(c.records) {
+		if c.opts.CheckWrites {
+			return fmt.Errorf("%w: unexpected write of %d bytes after the last recorded frame", ErrReplayMismatch, len(frame))
+		}
+		return nil
+	}
+	if c.opts.CheckWrites && !c.matchWrite(c.records[c.outNext].Data, frame, wantConfig) {
+		return fmt.Errorf("%w: record #%d", ErrReplayMismatch, c.outNext)
+	}
+	if c.opts.Lockstep {
+		c.anchorWall, c.anchorRec = time.Now(), c.records[c.outNext].Time
+	}
+	c.outNext = c.nextIndex(c.outNext+1, true)
+	close(c.wrote)
+	c.wrote = make(chan struct{})
+	return nil
+}
+
+// matchWrite reports whether the written frame matches the recorded one. wantConfig tells whether the
+// written frame is a want_config_id request, which matches any recorded want_config_id request.
+func (c *ReplayConn) matchWrite(want, got []byte, wantConfig bool) bool {
+	if wantConfig {
+		if _, ok := wantConfigNonce(want); ok {
+			return true
+		}
+	}
+	return c.opts.MatchWrite(want, got)
+}
+
+// closedErr returns io.EOF once the connection is closed.
+func (c *ReplayConn) closedErr() error {
+	select {
+	case <-c.closed:
+		return io.EOF
+	default:
+		return nil
+	}
+}
+
+// Close implements io.Closer. Pending reads return io.EOF.
+func (c *ReplayConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// Verify returns the first write mismatch, or an error when recorded outbound frames were never written.
+func (c *ReplayConn) Verify() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	if c.outNext < len(c.records) {
+		return fmt.Errorf("%w: record #%d was never written", ErrReplayMismatch, c.outNext)
+	}
+	return nil
+}
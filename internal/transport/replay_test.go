@@ -0,0 +1,204 @@
+package transport_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestReplayRoundTrip(t *testing.T) {
+	// Record a session with the fake radio.
+	var capture bytes.Buffer
+	cw, err := transport.NewCaptureWriter(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	radio := newRadio(t, fakeradio.Config{
+		MyInfo:   &meshtastic.MyNodeInfo{MyNodeNum: radioA},
+		Channels: []*meshtastic.Channel{{Index: 1, Role: meshtastic.Channel_SECONDARY}},
+	})
+	recorded := newClient(t, radio)
+	recorded.Tap = cw
+	connect(t, recorded)
+	if _, err := recorded.SendText(testContext(t), transport.BroadcastAddr, 0, "hello"); err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+	if err := recorded.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// The read loop may still be capturing the last frame.
+	recorded.Wait()
+
+	// Play it back to a fresh client doing the same.
+	cr, err := transport.NewCaptureReader(bytes.NewReader(capture.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, err := transport.NewReplayConn(cr, transport.ReplayOptions{Lockstep: true, CheckWrites: true, MatchWrite: sameIgnoringIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := transport.NewClient(transport.NewRadioStreamConn(replay), false)
+	// The replayed QueueStatus carries the recorded packet ID, so the text is taken as sent once this expires.
+	c.QueueStatusTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { _ = c.Close() })
+	connect(t, c)
+	if got := c.State.NodeInfo().GetMyNodeNum(); got != radioA {
+		t.Errorf("replayed radio %s, want %s", transport.NodeID(got), transport.NodeID(radioA))
+	}
+	if got, want := len(c.State.Channels()), len(recorded.State.Channels()); got != want {
+		t.Errorf("%d replayed channels, want %d", got, want)
+	}
+	if _, err := c.SendText(testContext(t), transport.BroadcastAddr, 0, "hello"); err != nil {
+		t.Fatalf("replayed SendText: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := replay.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	const gap = 200 * time.Millisecond
+	tests := []struct {
+		name     string
+		speed    float64
+		min, max time.Duration
+	}{
+		{name: "as fast as possible", speed: 0, max: gap / 4},
+		{name: "recorded pace", speed: 1, min: gap * 9 / 10, max: gap * 2},
+		{name: "four times faster", speed: 4, min: gap / 5, max: gap * 3 / 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			replay := replayOf(t, transport.ReplayOptions{Speed: tt.speed},
+				transport.CaptureRecord{Kind: transport.CaptureIn, Time: start, Data: []byte("first")},
+				transport.CaptureRecord{Kind: transport.CaptureIn, Time: start.Add(gap), Data: []byte("second")},
+			)
+			sc := transport.NewRadioStreamConn(replay)
+			if _, err := sc.ReadBytes(); err != nil {
+				t.Fatalf("first read: %v", err)
+			}
+			first := time.Now()
+			data, err := sc.ReadBytes()
+			if err != nil {
+				t.Fatalf("second read: %v", err)
+			}
+			if elapsed := time.Since(first); elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("second record after %v, want between %v and %v", elapsed, tt.min, tt.max)
+			}
+			if string(data) != "second" {
+				t.Errorf("second record = %q", data)
+			}
+		})
+	}
+}
+
+func TestReplayLockstep(t *testing.T) {
+	now := time.Now()
+	replay := replayOf(t, transport.ReplayOptions{Lockstep: true},
+		transport.CaptureRecord{Kind: transport.CaptureOut, Time: now, Data: []byte("request")},
+		transport.CaptureRecord{Kind: transport.CaptureIn, Time: now, Data: []byte("answer")},
+	)
+	sc := transport.NewRadioStreamConn(replay)
+	read := make(chan []byte, 1)
+	go func() {
+		data, _ := sc.ReadBytes()
+		read <- data
+	}()
+	select {
+	case data := <-read:
+		t.Fatalf("read %q before the request was written", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := sc.WriteBytes([]byte("request")); err != nil {
+		t.Fatalf("WriteBytes: %v", err)
+	}
+	if data := waitFor(t, read, "the answer"); string(data) != "answer" {
+		t.Errorf("read %q, want the answer", data)
+	}
+}
+
+func TestReplayCheckWrites(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		// wantWriteErr is whether the last write fails.
+		wantWriteErr bool
+		wantVerify   error
+	}{
+		{name: "matching writes", writes: []string{"one", "two"}},
+		{name: "divergent write", writes: []string{"one", "three"}, wantWriteErr: true, wantVerify: transport.ErrReplayMismatch},
+		{name: "write past the capture", writes: []string{"one", "two", "three"}, wantWriteErr: true, wantVerify: transport.ErrReplayMismatch},
+		{name: "missing write", writes: []string{"one"}, wantVerify: transport.ErrReplayMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			replay := replayOf(t, transport.ReplayOptions{CheckWrites: true},
+				transport.CaptureRecord{Kind: transport.CaptureOut, Time: now, Data: []byte("one")},
+				transport.CaptureRecord{Kind: transport.CaptureOut, Time: now, Data: []byte("two")},
+			)
+			sc := transport.NewRadioStreamConn(replay)
+			var err error
+			for _, w := range tt.writes {
+				if err = sc.WriteBytes([]byte(w)); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantWriteErr || err != nil && !errors.Is(err, transport.ErrReplayMismatch) {
+				t.Errorf("last write = %v, want a mismatch: %v", err, tt.wantWriteErr)
+			}
+			if err := replay.Verify(); !errors.Is(err, tt.wantVerify) {
+				t.Errorf("Verify = %v, want %v", err, tt.wantVerify)
+			}
+		})
+	}
+}
+
+// replayOf returns a ReplayConn playing records back with opts, which is closed when the test ends.
+func replayOf(t *testing.T, opts transport.ReplayOptions, records ...transport.CaptureRecord) *transport.ReplayConn {
+	t.Helper()
+	var capture bytes.Buffer
+	cw, err := transport.NewCaptureWriter(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		if err := cw.WriteRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cr, err := transport.NewCaptureReader(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, err := transport.NewReplayConn(cr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = replay.Close() })
+	return replay
+}
+
+// sameIgnoringIDs compares two ToRadio frames without the packet IDs, which differ between runs.
+func sameIgnoringIDs(want, got []byte) bool {
+	var w, g meshtastic.ToRadio
+	if proto.Unmarshal(want, &w) != nil || proto.Unmarshal(got, &g) != nil {
+		return bytes.Equal(want, got)
+	}
+	if w.GetPacket() != nil && g.GetPacket() != nil {
+		w.GetPacket().Id, g.GetPacket().Id = 0, 0
+	}
+	return proto.Equal(&w, &g)
+}
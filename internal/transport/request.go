@@ -0,0 +1,172 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// RoutingError is returned by SendAndWait when the mesh answers a packet with a Routing error.
+// Use errors.Is with the Err* values below to test for a specific reason.
+type RoutingError struct {
+	Reason meshtastic.Routing_Error
+}
+
+// Error implements the error interface.
+func (e *RoutingError) Error() string {
+	return fmt.Sprintf("routing error: %s", e.Reason)
+}
+
+// Is reports whether target is a RoutingError with the same reason.
+func (e *RoutingError) Is(target error) bool {
+	t, ok := target.(*RoutingError)
+	return ok && t.Reason == e.Reason
+}
+
+var (
+	// ErrNoRoute is returned when the radio has no route to the destination.
+	ErrNoRoute = &RoutingError{Reason: meshtastic.Routing_NO_ROUTE}
+	// ErrGotNAK is returned when the destination explicitly rejected the packet.
+	ErrGotNAK = &RoutingError{Reason: meshtastic.Routing_GOT_NAK}
+	// ErrRoutingTimeout is returned when the mesh gave up waiting for the destination.
+	ErrRoutingTimeout = &RoutingError{Reason: meshtastic.Routing_TIMEOUT}
+	// ErrMaxRetransmit is returned when the packet was retransmitted the maximum number of times without an ACK.
+	ErrMaxRetransmit = &RoutingError{Reason: meshtastic.Routing_MAX_RETRANSMIT}
+	// ErrNoChannel is returned when the packet was sent on a channel the radio does not have.
+	ErrNoChannel = &RoutingError{Reason: meshtastic.Routing_NO_CHANNEL}
+	// ErrTooLarge is returned when the payload does not fit in a packet.
+	ErrTooLarge = &RoutingError{Reason: meshtastic.Routing_TOO_LARGE}
+	// ErrNoAppResponse is returned when the destination did not answer a request.
+	ErrNoAppResponse = &RoutingError{Reason: meshtastic.Routing_NO_RESPONSE}
+	// ErrDutyCycleLimit is returned when the radio is over its regional duty cycle limit.
+	ErrDutyCycleLimit = &RoutingError{Reason: meshtastic.Routing_DUTY_CYCLE_LIMIT}
+	// ErrNotAuthorized is returned when the destination refused an admin request.
+	ErrNotAuthorized = &RoutingError{Reason: meshtastic.Routing_NOT_AUTHORIZED}
+	// ErrPKIFailed is returned when the packet could not be encrypted for the destination.
+	ErrPKIFailed = &RoutingError{Reason: meshtastic.Routing_PKI_FAILED}
+	// ErrPKIUnknownPubkey is returned when the radio does not know the public key of the destination.
+	ErrPKIUnknownPubkey = &RoutingError{Reason: meshtastic.Routing_PKI_UNKNOWN_PUBKEY}
+)
+
+// ErrNoAnswerRequested is returned by SendAndWait for a packet asking for neither an ACK nor a response,
+// which nothing would answer.
+var ErrNoAnswerRequested = errors.New("packet asks for neither an ACK nor a response")
+
+// packetIDs allocates packet IDs for outgoing packets and tracks the ones awaiting an answer.
+type packetIDs struct {
+	mu      sync.Mutex
+	next    uint32
+	pending map[uint32]chan *meshtastic.MeshPacket
+}
+
+// newID returns a fresh, non-zero packet ID.
+func (p *packetIDs) newID() uint32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next == 0 {
+		// Start at a random point so IDs do not collide with those of a previous run.
+		var seed uint32
+		if err := binary.Read(rand.Reader, binary.LittleEndian, &seed); err != nil || seed == 0 {
+			seed = 1
+		}
+		p.next = seed
+	}
+	id := p.next
+	p.next++
+	if p.next == 0 {
+		p.next = 1
+	}
+	return id
+}
+
+// wait registers id as pending and returns the channel answers for it are delivered on.
+func (p *packetIDs) wait(id uint32) chan *meshtastic.MeshPacket {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = make(map[uint32]chan *meshtastic.MeshPacket)
+	}
+	ch := make(chan *meshtastic.MeshPacket, 4)
+	p.pending[id] = ch
+	return ch
+}
+
+// done stops tracking id.
+func (p *packetIDs) done(id uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, id)
+}
+
+// resolve hands packet to whoever waits for the packet it answers.
+func (p *packetIDs) resolve(packet *meshtastic.MeshPacket) {
+	requestID := packet.GetDecoded().GetRequestId()
+	if requestID == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ch, ok := p.pending[requestID]; ok {
+		select {
+		case ch <- packet:
+		default:
+		}
+	}
+}
+
+// NewPacketID returns a fresh, non-zero packet ID for an outgoing MeshPacket.
+func (c *Client) NewPacketID() uint32 {
+	return c.packets.newID()
+}
+
+// SendAndWait sends packet and waits for the matching answer, which is returned.
+// A packet with Id 0 gets a fresh ID assigned. Unless the packet asks for an application response
+// (Data.WantResponse) the Routing ACK is the answer; otherwise the reply carrying the packet's ID in
+// Data.RequestId is. Routing errors are returned as *RoutingError, together with the Routing packet.
+// The packet must set WantAck or Data.WantResponse, otherwise ErrNoAnswerRequested is returned and nothing
+// is sent; use SendPacket for packets which are not answered.
+func (c *Client) SendAndWait(ctx context.Context, packet *meshtastic.MeshPacket) (*meshtastic.MeshPacket, error) {
+	if !packet.GetWantAck() && !packet.GetDecoded().GetWantResponse() {
+		return nil, ErrNoAnswerRequested
+	}
+	if packet.GetId() == 0 {
+		packet.Id = c.NewPacketID()
+	}
+	answers := c.packets.wait(packet.GetId())
+	defer c.packets.done(packet.GetId())
+
+	if err := c.SendPacket(ctx, packet); err != nil {
+		return nil, fmt.Errorf("sending packet: %w", err)
+	}
+
+	wantResponse := packet.GetDecoded().GetWantResponse()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.ctx.Done():
+			return nil, ErrClosed
+		case answer := <-answers:
+			if answer.GetDecoded().GetPortnum() != meshtastic.PortNum_ROUTING_APP {
+				return answer, nil
+			}
+			routing := &meshtastic.Routing{}
+			if err := proto.Unmarshal(answer.GetDecoded().GetPayload(), routing); err != nil {
+				return answer, fmt.Errorf("decoding routing answer: %w", err)
+			}
+			if reason := routing.GetErrorReason(); reason != meshtastic.Routing_NONE {
+				return answer, &RoutingError{Reason: reason}
+			}
+			if !wantResponse {
+				return answer, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package transport_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSendAndWait(t *testing.T) {
+	metadataRequest, _ := proto.Marshal(&meshtastic.AdminMessage{
+		PayloadVariant: &meshtastic.AdminMessage_GetDeviceMetadataRequest{GetDeviceMetadataRequest: true},
+	})
+	tests := []struct {
+		name   string
+		route  meshtastic.Routing_Error
+		packet func(self uint32) *meshtastic.MeshPacket
+		// wantPort is the port of the expected answer, zero when an error is expected.
+		wantPort meshtastic.PortNum
+		wantErr  error
+	}{
+		{
+			name:     "ACK",
+			packet:   func(uint32) *meshtastic.MeshPacket { return textPacket(7, true) },
+			wantPort: meshtastic.PortNum_ROUTING_APP,
+		},
+		{
+			name:    "NAK",
+			route:   meshtastic.Routing_GOT_NAK,
+			packet:  func(uint32) *meshtastic.MeshPacket { return textPacket(7, true) },
+			wantErr: transport.ErrGotNAK,
+		},
+		{
+			name:    "no route",
+			route:   meshtastic.Routing_NO_ROUTE,
+			packet:  func(uint32) *meshtastic.MeshPacket { return textPacket(7, true) },
+			wantErr: transport.ErrNoRoute,
+		},
+		{
+			name: "application response",
+			packet: func(self uint32) *meshtastic.MeshPacket {
+				return &meshtastic.MeshPacket{To: self, WantAck: true, PayloadVariant: &meshtastic.MeshPacket_Decoded{
+					Decoded: &meshtastic.Data{Portnum: meshtastic.PortNum_ADMIN_APP, Payload: metadataRequest, WantResponse: true},
+				}}
+			},
+			wantPort: meshtastic.PortNum_ADMIN_APP,
+		},
+		{
+			name:    "nothing to wait for",
+			packet:  func(uint32) *meshtastic.MeshPacket { return textPacket(7, false) },
+			wantErr: transport.ErrNoAnswerRequested,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{Route: func(*meshtastic.MeshPacket) meshtastic.Routing_Error { return tt.route }})
+			c := newClient(t, radio)
+			connect(t, c)
+
+			packet := tt.packet(radio.NodeNum())
+			answer, err := c.SendAndWait(testContext(t), packet)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SendAndWait error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SendAndWait: %v", err)
+			}
+			if packet.GetId() == 0 {
+				t.Error("packet got no ID")
+			}
+			if got := answer.GetDecoded().GetPortnum(); got != tt.wantPort {
+				t.Errorf("answer on port %v, want %v", got, tt.wantPort)
+			}
+			if got := answer.GetDecoded().GetRequestId(); got != packet.GetId() {
+				t.Errorf("answer to packet %d, want %d", got, packet.GetId())
+			}
+		})
+	}
+}
+
+// textPacket returns a text message to the node to.
+func textPacket(to uint32, wantAck bool) *meshtastic.MeshPacket {
+	return &meshtastic.MeshPacket{To: to, WantAck: wantAck, PayloadVariant: &meshtastic.MeshPacket_Decoded{
+		Decoded: &meshtastic.Data{Portnum: meshtastic.PortNum_TEXT_MESSAGE_APP, Payload: []byte("hello")},
+	}}
+}
@@ -0,0 +1,446 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// DefaultServerPeerQueue is how many messages a peer of a Server may fall behind before it is disconnected.
+	DefaultServerPeerQueue = 256
+	// serverIDLifetime is how long a Server remembers which peer sent a packet, to route the answers back.
+	serverIDLifetime = 10 * time.Minute
+	// Special want_config_id nonces which ask for part of the config download, as understood by the firmware.
+	configNonceOnlyConfig = 69420
+	configNonceOnlyNodes  = 69421
+)
+
+// errPeerDisconnect is returned by a peer's read loop when the peer said goodbye.
+var errPeerDisconnect = errors.New("peer disconnected")
+
+// Server shares the radio of a Client with clients connecting over TCP, so several programs can use
+// a radio that only one of them could open. Every peer gets the config download answered from the
+// client's State, under its own want_config_id, once the client's own download is complete, and then
+// every message the radio sends. Packets of the peers are sent through the client's send queue with a
+// packet ID of the client, which is swapped back in the answers, so ACKs and responses reach the peer
+// which sent the packet under the ID it used.
+type Server struct {
+	client *Client
+	log    *slog.Logger
+
+	mu    sync.Mutex
+	peers map[*serverPeer]struct{}
+	// ids maps the packet IDs given to packets of peers to the peer and the ID it used.
+	ids map[uint32]peerPacket
+
+	// PeerQueue is how many messages a peer may fall behind before it is disconnected, and how many of its
+	// packets may wait for the send queue of the client before further ones are dropped.
+	PeerQueue int
+}
+
+// peerPacket is a packet of a peer sent to the radio under another ID.
+type peerPacket struct {
+	peer    *serverPeer
+	id      uint32
+	expires time.Time
+}
+
+// serverPeer is a client connected to a Server.
+type serverPeer struct {
+	sc   *StreamConn
+	addr string
+	// out holds the batches of messages waiting to be written to the peer.
+	out chan []*meshtastic.FromRadio
+	// send holds the packets of the peer waiting for the send queue of the client.
+	send      chan *meshtastic.MeshPacket
+	closed    chan struct{}
+	closeOnce sync.Once
+	// configured is set once the peer got the config, from then on it gets what the radio sends.
+	configured bool
+	// pendingConfig holds the want_config_id nonces waiting for the config download of the client.
+	pendingConfig []uint32
+}
+
+// NewServer creates a Server sharing the radio of c. It adds itself to the middlewares of c, so like Use
+// it is meant to be called before c connects.
+func NewServer(c *Client) *Server {
+	s := &Server{
+		client:    c,
+		log:       slog.Default().WithGroup("server"),
+		peers:     make(map[*serverPeer]struct{}),
+		ids:       make(map[uint32]peerPacket),
+		PeerQueue: DefaultServerPeerQueue,
+	}
+	c.Use(s)
+	return s
+}
+
+// ListenAndServe listens on the TCP address addr and serves peers until ctx is done, see Serve.
+// An empty addr listens on DefaultTCPPort of the loopback interface; the peers can use the radio
+// without authentication, so other hosts have to be let in explicitly, such as with ":4403".
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if addr == "" {
+		addr = net.JoinHostPort("127.0.0.1", strconv.Itoa(DefaultTCPPort))
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", addr, err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts peers on ln until ctx is done or the client stops for good. It then closes ln and the
+// connected peers. Serve returns nil after ctx is done and the error which stopped it otherwise.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.client.Done():
+		}
+		_ = ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer s.closePeers()
+	s.log.Info("serving", "addr", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			select {
+			case <-s.client.Done():
+				return ErrClosed
+			default:
+			}
+			return fmt.Errorf("accepting peer: %w", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.servePeer(ctx, conn)
+		}()
+	}
+}
+
+// Peers returns the number of connected peers.
+func (s *Server) Peers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.peers)
+}
+
+// servePeer handles the messages of a peer until it disconnects or ctx is done.
+func (s *Server) servePeer(ctx context.Context, conn net.Conn) {
+	p := &serverPeer{
+		sc:     NewRadioStreamConn(conn),
+		addr:   conn.RemoteAddr().String(),
+		out:    make(chan []*meshtastic.FromRadio, max(s.PeerQueue, 1)),
+		send:   make(chan *meshtastic.MeshPacket, max(s.PeerQueue, 1)),
+		closed: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.peers[p] = struct{}{}
+	s.mu.Unlock()
+	s.log.Info("peer connected", "peer", p.addr)
+
+	go s.writeLoop(p)
+	go s.sendLoop(ctx, p)
+	err := s.readLoop(ctx, p)
+
+	s.mu.Lock()
+	delete(s.peers, p)
+	s.mu.Unlock()
+	p.close()
+	s.log.Info("peer disconnected", "peer", p.addr, "err", err)
+}
+
+// readLoop passes the messages of p on until p disconnects or ctx is done.
+func (s *Server) readLoop(ctx context.Context, p *serverPeer) error {
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-p.closed:
+		}
+		_ = p.sc.Close()
+	}()
+	for {
+		data, err := p.sc.ReadBytes()
+		if err != nil {
+			return err
+		}
+		msg := &meshtastic.ToRadio{}
+		if err := proto.Unmarshal(data, msg); err != nil {
+			p.sc.countDecodeError()
+			s.log.Warn("error decoding message from peer", "peer", p.addr, "err", err)
+			continue
+		}
+		if err := s.handleToRadio(p, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// writeLoop writes the messages queued for p until p is closed.
+func (s *Server) writeLoop(p *serverPeer) {
+	for {
+		select {
+		case <-p.closed:
+			return
+		case batch := <-p.out:
+			for _, msg := range batch {
+				if err := p.sc.Write(msg); err != nil {
+					p.close()
+					return
+				}
+			}
+		}
+	}
+}
+
+// sendLoop sends the packets of p through the client, one after the other, until p is closed. It keeps
+// the read loop of p going while the send queue of the client is full.
+func (s *Server) sendLoop(ctx context.Context, p *serverPeer) {
+	for {
+		select {
+		case <-p.closed:
+			return
+		case packet := <-p.send:
+			if err := s.client.SendPacket(ctx, packet); err != nil {
+				s.log.Warn("sending packet of peer", "peer", p.addr, "id", packet.GetId(), "err", err)
+			}
+		}
+	}
+}
+
+// close disconnects the peer.
+func (p *serverPeer) close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		_ = p.sc.Close()
+	})
+}
+
+// closePeers disconnects all peers.
+func (s *Server) closePeers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.peers {
+		p.close()
+	}
+}
+
+// handleToRadio answers or forwards a message of p.
+func (s *Server) handleToRadio(p *serverPeer, msg *meshtastic.ToRadio) error {
+	switch msg.GetPayloadVariant().(type) {
+	case *meshtastic.ToRadio_WantConfigId:
+		s.sendConfig(p, msg.GetWantConfigId())
+	case *meshtastic.ToRadio_Packet:
+		s.forward(p, msg.GetPacket())
+	case *meshtastic.ToRadio_Disconnect:
+		return errPeerDisconnect
+	case *meshtastic.ToRadio_Heartbeat:
+		// The client keeps the link to the radio awake on its own.
+	default:
+		if err := s.client.SendToRadio(msg); err != nil {
+			s.log.Warn("forwarding message of peer", "peer", p.addr, "err", err)
+		}
+	}
+	return nil
+}
+
+// sendConfig answers want_config_id of p, or keeps it for when the config download of the client completes.
+func (s *Server) sendConfig(p *serverPeer, nonce uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.client.State.Complete() {
+		s.log.Debug("peer waits for the config", "peer", p.addr, "id", nonce)
+		p.pendingConfig = append(p.pendingConfig, nonce)
+		return
+	}
+	s.enqueueConfig(p, nonce)
+}
+
+// sendPendingConfigs answers the want_config_id nonces of the peers which waited for the config download.
+func (s *Server) sendPendingConfigs() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.client.State.Complete() {
+		return
+	}
+	for p := range s.peers {
+		for _, nonce := range p.pendingConfig {
+			s.enqueueConfig(p, nonce)
+		}
+		p.pendingConfig = nil
+	}
+}
+
+// enqueueConfig queues the config for p from the State of the client, in the order the firmware uses,
+// and has p receive what the radio sends from then on. Holding s.mu keeps fanOut from passing on a message
+// in between, so p misses none. s.mu must be held.
+func (s *Server) enqueueConfig(p *serverPeer, nonce uint32) {
+	state := &s.client.State
+	myInfo := state.NodeInfo()
+	var own *meshtastic.NodeInfo
+	var others []*meshtastic.NodeInfo
+	for _, node := range state.Nodes() {
+		if node.GetNum() == myInfo.GetMyNodeNum() {
+			own = node
+		} else {
+			others = append(others, node)
+		}
+	}
+
+	var msgs []*meshtastic.FromRadio
+	add := func(msg *meshtastic.FromRadio) { msgs = append(msgs, msg) }
+	if myInfo != nil {
+		add(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_MyInfo{MyInfo: proto.Clone(myInfo).(*meshtastic.MyNodeInfo)}})
+	}
+	if own != nil {
+		add(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_NodeInfo{NodeInfo: own}})
+	}
+	if nonce != configNonceOnlyNodes {
+		if metadata := state.DeviceMetadata(); metadata != nil {
+			add(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_Metadata{Metadata: metadata}})
+		}
+		for _, channel := range state.Channels() {
+			add(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_Channel{Channel: channel}})
+		}
+		for _, cfg := range state.Configs() {
+			add(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_Config{Config: cfg}})
+		}
+		for _, cfg := range state.Modules() {
+			add(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_ModuleConfig{ModuleConfig: cfg}})
+		}
+	}
+	if nonce != configNonceOnlyConfig {
+		for _, node := range others {
+			add(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_NodeInfo{NodeInfo: node}})
+		}
+	}
+	add(&meshtastic.FromRadio{PayloadVariant: &meshtastic.FromRadio_ConfigCompleteId{ConfigCompleteId: nonce}})
+
+	s.log.Debug("sending config to peer", "peer", p.addr, "id", nonce, "messages", len(msgs))
+	p.configured = true
+	s.enqueue(p, msgs)
+}
+
+// forward queues packet of p for the radio under a packet ID of the client. A packet p sent without an ID
+// keeps the one it gets here in the answers, which still go to p.
+func (s *Server) forward(p *serverPeer, packet *meshtastic.MeshPacket) {
+	id := packet.GetId()
+	packet.Id = s.client.NewPacketID()
+	if id == 0 {
+		id = packet.Id
+	}
+	now := time.Now()
+	s.mu.Lock()
+	for radioID, sent := range s.ids {
+		if now.After(sent.expires) {
+			delete(s.ids, radioID)
+		}
+	}
+	s.ids[packet.Id] = peerPacket{peer: p, id: id, expires: now.Add(serverIDLifetime)}
+	s.mu.Unlock()
+
+	select {
+	case p.send <- packet:
+	case <-p.closed:
+	default:
+		s.log.Warn("too many packets of peer waiting, dropping packet", "peer", p.addr, "id", id)
+	}
+}
+
+// Inbound implements Middleware. It passes msg on to every peer which downloaded the config, and answers
+// the peers waiting for the config once the State of the client is complete.
+func (s *Server) Inbound(next InboundFunc) InboundFunc {
+	return func(ctx context.Context, msg *meshtastic.FromRadio) error {
+		s.fanOut(msg)
+		err := next(ctx, msg)
+		if _, ok := msg.GetPayloadVariant().(*meshtastic.FromRadio_ConfigCompleteId); ok {
+			s.sendPendingConfigs()
+		}
+		return err
+	}
+}
+
+// Outbound implements Middleware.
+func (s *Server) Outbound(next OutboundFunc) OutboundFunc {
+	return next
+}
+
+// fanOut queues msg for the peers. A message about a packet of a peer goes to that peer with the ID it used.
+func (s *Server) fanOut(msg *meshtastic.FromRadio) {
+	switch msg.GetPayloadVariant().(type) {
+	case *meshtastic.FromRadio_ConfigCompleteId:
+		// The config download of the client itself, peers get theirs from sendConfig.
+		return
+	case *meshtastic.FromRadio_MyInfo, *meshtastic.FromRadio_Metadata, *meshtastic.FromRadio_NodeInfo,
+		*meshtastic.FromRadio_Channel, *meshtastic.FromRadio_Config, *meshtastic.FromRadio_ModuleConfig:
+		if !s.client.State.Complete() {
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner, own := s.restoreID(msg)
+	for p := range s.peers {
+		if !p.configured {
+			continue
+		}
+		if p == owner {
+			s.enqueue(p, []*meshtastic.FromRadio{own})
+		} else {
+			s.enqueue(p, []*meshtastic.FromRadio{msg})
+		}
+	}
+}
+
+// restoreID returns the peer whose packet msg refers to, by QueueStatus, request ID or reply ID, and a copy
+// of msg carrying the ID that peer used. s.mu must be held.
+func (s *Server) restoreID(msg *meshtastic.FromRadio) (*serverPeer, *meshtastic.FromRadio) {
+	if sent, ok := s.ids[msg.GetQueueStatus().GetMeshPacketId()]; ok {
+		own := proto.Clone(msg).(*meshtastic.FromRadio)
+		own.GetQueueStatus().MeshPacketId = sent.id
+		return sent.peer, own
+	}
+	decoded := msg.GetPacket().GetDecoded()
+	if sent, ok := s.ids[decoded.GetRequestId()]; ok {
+		own := proto.Clone(msg).(*meshtastic.FromRadio)
+		own.GetPacket().GetDecoded().RequestId = sent.id
+		return sent.peer, own
+	}
+	if sent, ok := s.ids[decoded.GetReplyId()]; ok {
+		own := proto.Clone(msg).(*meshtastic.FromRadio)
+		own.GetPacket().GetDecoded().ReplyId = sent.id
+		return sent.peer, own
+	}
+	return nil, nil
+}
+
+// enqueue queues msgs for p, disconnecting p when it fell too far behind. s.mu must be held.
+func (s *Server) enqueue(p *serverPeer, msgs []*meshtastic.FromRadio) {
+	select {
+	case p.out <- msgs:
+	case <-p.closed:
+	default:
+		s.log.Warn("peer too slow, disconnecting", "peer", p.addr)
+		p.close()
+	}
+}
@@ -0,0 +1,226 @@
+package transport_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name string
+		// peersFirst connects the peers before the client of the server downloaded the config.
+		peersFirst bool
+	}{
+		{name: "radio connected first"},
+		{name: "peers connect before the radio", peersFirst: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := newRadio(t, fakeradio.Config{MyInfo: &meshtastic.MyNodeInfo{MyNodeNum: radioA}})
+			client := newClient(t, radio)
+			ln := serve(t, transport.NewServer(client))
+			peers := []*transport.Client{newPeer(t, ln), newPeer(t, ln)}
+
+			if !tt.peersFirst {
+				connect(t, client)
+			}
+			connected := make(chan error, len(peers))
+			for _, peer := range peers {
+				go func() { connected <- peer.Connect(testContext(t)) }()
+			}
+			if tt.peersFirst {
+				// Give the peers time to ask for the config, which the server has to hold back.
+				time.Sleep(50 * time.Millisecond)
+				connect(t, client)
+			}
+			for range peers {
+				if err := waitFor(t, connected, "the peers to connect"); err != nil {
+					t.Fatalf("peer Connect: %v", err)
+				}
+			}
+			for _, peer := range peers {
+				if got := peer.State.NodeInfo().GetMyNodeNum(); got != radioA {
+					t.Errorf("peer sees radio %s, want %s", transport.NodeID(got), transport.NodeID(radioA))
+				}
+			}
+
+			// Both peers use the same packet ID; each gets the ACK of its own packet under that ID.
+			const peerID = 0x1234
+			answers := make(chan *meshtastic.MeshPacket, len(peers))
+			errs := make(chan error, len(peers))
+			for _, peer := range peers {
+				go func() {
+					answer, err := peer.SendAndWait(testContext(t), &meshtastic.MeshPacket{
+						Id:      peerID,
+						To:      9,
+						WantAck: true,
+						PayloadVariant: &meshtastic.MeshPacket_Decoded{Decoded: &meshtastic.Data{
+							Portnum: meshtastic.PortNum_TEXT_MESSAGE_APP,
+							Payload: []byte("hi"),
+						}},
+					})
+					if err != nil {
+						errs <- err
+						return
+					}
+					answers <- answer
+				}()
+			}
+			for range peers {
+				select {
+				case err := <-errs:
+					t.Fatalf("peer SendAndWait: %v", err)
+				case answer := <-answers:
+					if got := answer.GetDecoded().GetRequestId(); got != peerID {
+						t.Errorf("answer to request %#x, want %#x", got, peerID)
+					}
+				case <-time.After(testTimeout):
+					t.Fatal("timed out waiting for the answers")
+				}
+			}
+			sent := map[uint32]bool{}
+			for _, msg := range radio.Received() {
+				if packet := msg.GetPacket(); packet != nil {
+					sent[packet.GetId()] = true
+				}
+			}
+			if len(sent) != len(peers) || sent[peerID] {
+				t.Errorf("radio received packet IDs %v, want %d IDs of the client", sent, len(peers))
+			}
+
+			// A packet the radio receives reaches every peer.
+			heard := make(chan struct{}, len(peers))
+			for _, peer := range peers {
+				peer.Events.RegisterHandler(transport.EventMeshPacketReceived, func(event transport.Event) {
+					if event.Data.(*meshtastic.MeshPacket).GetFrom() == 7 {
+						heard <- struct{}{}
+					}
+				})
+			}
+			radio.Inject(&meshtastic.MeshPacket{From: 7, To: transport.BroadcastAddr, Id: 99})
+			for range peers {
+				waitFor(t, heard, "the peers to receive the packet")
+			}
+		})
+	}
+}
+
+func TestServerListenAndServe(t *testing.T) {
+	// The default address, which must be free for the test.
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(transport.DefaultTCPPort))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", addr, err)
+	}
+	_ = ln.Close()
+
+	radio := newRadio(t, fakeradio.Config{MyInfo: &meshtastic.MyNodeInfo{MyNodeNum: radioA}})
+	client := newClient(t, radio)
+	server := transport.NewServer(client)
+	connect(t, client)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.ListenAndServe(ctx, "") }()
+	t.Cleanup(func() {
+		cancel()
+		<-served
+	})
+
+	peer := transport.NewDialClient(func(ctx context.Context) (*transport.StreamConn, error) {
+		return transport.DialTCP(ctx, "127.0.0.1", transport.TCPOptions{})
+	}, false)
+	peer.Backoff = transport.Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2}
+	t.Cleanup(func() {
+		_ = peer.Close()
+		peer.Wait()
+	})
+	eventually(t, "the peer to connect on the default address", func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		return peer.Connect(ctx) == nil
+	})
+	if got := peer.State.NodeInfo().GetMyNodeNum(); got != radioA {
+		t.Errorf("peer sees radio %s, want %s", transport.NodeID(got), transport.NodeID(radioA))
+	}
+}
+
+// pipeListener is a net.Listener handing out the server ends of net.Pipe connections made by dial.
+type pipeListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// dial connects a new peer to the listener.
+func (l *pipeListener) dial(ctx context.Context) (*transport.StreamConn, error) {
+	server, peer := net.Pipe()
+	select {
+	case l.conns <- server:
+		return transport.NewRadioStreamConn(peer), nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// pipeAddr is the address of a pipeListener.
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// serve runs s on a pipeListener until the test ends.
+func serve(t *testing.T, s *transport.Server) *pipeListener {
+	t.Helper()
+	ln := newPipeListener()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return ln
+}
+
+// newPeer creates a client connecting to a server through ln, which is closed when the test ends.
+func newPeer(t *testing.T, ln *pipeListener) *transport.Client {
+	t.Helper()
+	c := transport.NewDialClient(ln.dial, false)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// NodeChange is the Data of EventNodeAdded, EventNodeRenamed and EventNodeMoved.
+// Before is nil for a node seen for the first time.
+type NodeChange struct {
+	Before, After *Node
+}
+
+// ChannelChange is the Data of EventChannelChanged. Before is nil for a new channel,
+// After is nil for a channel the radio no longer reported in its config download.
+type ChannelChange struct {
+	Before, After *meshtastic.Channel
+}
+
+// ConfigChange is the Data of EventConfigChanged. Before is nil for a new section,
+// After is nil for a section the radio no longer reported in its config download.
+type ConfigChange struct {
+	Before, After *meshtastic.Config
+}
+
+// ModuleConfigChange is the Data of EventModuleConfigChanged. Before is nil for a new module,
+// After is nil for a module the radio no longer reported in its config download.
+type ModuleConfigChange struct {
+	Before, After *meshtastic.ModuleConfig
+}
+
+// MyInfoChange is the Data of EventMyInfoChanged. Before is nil the first time the radio reports it.
+type MyInfoChange struct {
+	Before, After *meshtastic.MyNodeInfo
+}
+
+// MetadataChange is the Data of EventMetadataChanged. Before is nil the first time the radio reports it.
+type MetadataChange struct {
+	Before, After *meshtastic.DeviceMetadata
+}
+
+// SetNotify makes the state report its changes to notify, usually the Dispatch of an EventDispatcher.
+// Changes are reported after the state has been updated and unlocked. Restoring a snapshot reports nothing.
+func (s *State) SetNotify(notify func(Event)) {
+	s.Lock()
+	s.notify = notify
+	s.Unlock()
+	s.nodes.mu.Lock()
+	s.nodes.notify = notify
+	s.nodes.mu.Unlock()
+}
+
+// emit reports events to the notify function, with s unlocked.
+func (s *State) emit(events []Event) {
+	s.RLock()
+	notify := s.notify
+	s.RUnlock()
+	for _, event := range events {
+		if notify != nil {
+			notify(event)
+		}
+	}
+}
+
+// emit reports events to the notify function, with db unlocked.
+func (db *NodeDB) emit(events []Event) {
+	db.mu.RLock()
+	notify := db.notify
+	db.mu.RUnlock()
+	for _, event := range events {
+		if notify != nil {
+			notify(event)
+		}
+	}
+}
+
+// nodeEvents returns the events for a node which changed from before to after. Before is nil for a new node.
+func nodeEvents(before, after *Node) []Event {
+	change := NodeChange{Before: before, After: after}
+	if before == nil {
+		return []Event{{Type: EventNodeAdded, Data: change}}
+	}
+	var events []Event
+	if before.Info.GetUser().GetLongName() != after.Info.GetUser().GetLongName() ||
+		before.Info.GetUser().GetShortName() != after.Info.GetUser().GetShortName() {
+		events = append(events, Event{Type: EventNodeRenamed, Data: change})
+	}
+	// Positions are sent again with a fresh timestamp, so only the coordinates count as a move.
+	p, q := before.Info.GetPosition(), after.Info.GetPosition()
+	if p.GetLatitudeI() != q.GetLatitudeI() || p.GetLongitudeI() != q.GetLongitudeI() || p.GetAltitude() != q.GetAltitude() {
+		events = append(events, Event{Type: EventNodeMoved, Data: change})
+	}
+	return events
+}
+
+// changeEvent returns the event of eventType with data change, or nothing when before and after are equal.
+func changeEvent[T proto.Message](eventType EventType, before, after T, change any) []Event {
+	if proto.Equal(before, after) {
+		return nil
+	}
+	return []Event{{Type: eventType, Data: change}}
+}
@@ -0,0 +1,71 @@
+package transport_test
+
+import (
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+func TestStateInfoEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(state *transport.State)
+		want   []transport.EventType
+	}{
+		{
+			name:   "same node info",
+			update: func(state *transport.State) { state.SetNodeInfo(&meshtastic.MyNodeInfo{MyNodeNum: 7, RebootCount: 1}) },
+		},
+		{
+			name:   "node info after a reboot",
+			update: func(state *transport.State) { state.SetNodeInfo(&meshtastic.MyNodeInfo{MyNodeNum: 7, RebootCount: 2}) },
+			want:   []transport.EventType{transport.EventMyInfoChanged},
+		},
+		{
+			name: "same metadata",
+			update: func(state *transport.State) {
+				state.SetDeviceMetadata(&meshtastic.DeviceMetadata{FirmwareVersion: "2.5.0"})
+			},
+		},
+		{
+			name: "new firmware",
+			update: func(state *transport.State) {
+				state.SetDeviceMetadata(&meshtastic.DeviceMetadata{FirmwareVersion: "2.6.0"})
+			},
+			want: []transport.EventType{transport.EventMetadataChanged},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state transport.State
+			var events []transport.Event
+			state.SetNotify(func(event transport.Event) { events = append(events, event) })
+			state.SetNodeInfo(&meshtastic.MyNodeInfo{MyNodeNum: 7, RebootCount: 1})
+			state.SetDeviceMetadata(&meshtastic.DeviceMetadata{FirmwareVersion: "2.5.0"})
+			if len(events) != 2 {
+				t.Fatalf("first reports made %d events, want 2", len(events))
+			}
+			if change := events[0].Data.(transport.MyInfoChange); change.Before != nil || change.After.GetMyNodeNum() != 7 {
+				t.Errorf("first MyInfoChange = %+v, want no Before and node 7 After", change)
+			}
+
+			events = nil
+			tt.update(&state)
+			if len(events) != len(tt.want) {
+				t.Fatalf("got %d events, want %v", len(events), tt.want)
+			}
+			for i, event := range events {
+				if event.Type != tt.want[i] {
+					t.Errorf("event %d = %s, want %s", i, event.Type, tt.want[i])
+				}
+			}
+			if len(events) == 1 && events[0].Type == transport.EventMyInfoChanged {
+				change := events[0].Data.(transport.MyInfoChange)
+				if change.Before.GetRebootCount() != 1 || change.After.GetRebootCount() != 2 {
+					t.Errorf("MyInfoChange = %+v, want reboot count 1 before and 2 after", change)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultStateSaveInterval is how often a client checks whether its State changed and needs saving to StateFile.
+const DefaultStateSaveInterval = 10 * time.Second
+
+// stateSnapshotVersion is the version of the snapshot format written by State.Snapshot.
+// Bump it when the layout of stateSnapshot changes and teach Restore to upgrade the older layout.
+// Changes to the protobuf messages need no bump: they are stored as protobuf JSON, unknown fields
+// are skipped when reading and missing ones keep their default.
+const stateSnapshotVersion = 1
+
+var (
+	// ErrSnapshotVersion is returned when restoring a snapshot written by a newer, incompatible version.
+	ErrSnapshotVersion = errors.New("state snapshot has an unsupported version")
+	// ErrSnapshotRadio is returned when restoring a snapshot of another radio than the one the State holds.
+	ErrSnapshotRadio = errors.New("state snapshot belongs to another radio")
+)
+
+// stateSnapshot is the file layout of a State snapshot.
+type stateSnapshot struct {
+	Version int       `json:"version"`
+	Saved   time.Time `json:"saved"`
+	// NodeNum is the node number of the radio the snapshot was taken from, zero if it was not known yet.
+	NodeNum  uint32            `json:"node_num,omitempty"`
+	MyInfo   json.RawMessage   `json:"my_info,omitempty"`
+	Metadata json.RawMessage   `json:"metadata,omitempty"`
+	Nodes    []snapshotNode    `json:"nodes,omitempty"`
+	Channels []json.RawMessage `json:"channels,omitempty"`
+	Configs  []json.RawMessage `json:"configs,omitempty"`
+	Modules  []json.RawMessage `json:"modules,omitempty"`
+}
+
+// snapshotNode is a NodeDB entry in a snapshot.
+type snapshotNode struct {
+	Info json.RawMessage `json:"info"`
+	RSSI int32           `json:"rssi,omitempty"`
+}
+
+// Snapshot encodes the node database, channels, configs, module configs, node info and device metadata.
+// The config download progress is not part of it.
+func (s *State) Snapshot() ([]byte, error) {
+	snap := stateSnapshot{Version: stateSnapshotVersion, Saved: time.Now().UTC()}
+	var err error
+	s.RLock()
+	snap.NodeNum = s.nodeInfo.GetMyNodeNum()
+	if s.nodeInfo != nil {
+		snap.MyInfo, err = protojson.Marshal(s.nodeInfo)
+	}
+	if err == nil && s.deviceMetadata != nil {
+		snap.Metadata, err = protojson.Marshal(s.deviceMetadata)
+	}
+	if err == nil {
+		snap.Channels, err = marshalAll(s.channels)
+	}
+	if err == nil {
+		snap.Configs, err = marshalAll(s.configs)
+	}
+	if err == nil {
+		snap.Modules, err = marshalAll(s.modules)
+	}
+	s.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("encoding state: %w", err)
+	}
+	for _, node := range s.nodes.All() {
+		info, err := protojson.Marshal(node.Info)
+		if err != nil {
+			return nil, fmt.Errorf("encoding node %s: %w", node.ID(), err)
+		}
+		snap.Nodes = append(snap.Nodes, snapshotNode{Info: info, RSSI: node.RSSI})
+	}
+	return json.MarshalIndent(snap, "", "  ")
+}
+
+// Restore replaces the state with a snapshot written by Snapshot. The restored data is readable right away;
+// the next config download from the radio updates it and drops the channels and configs the radio no longer has.
+// A snapshot of another radio than the one the State already holds is refused with ErrSnapshotRadio.
+func (s *State) Restore(data []byte) error {
+	var snap stateSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decoding state snapshot: %w", err)
+	}
+	if snap.Version < 1 || snap.Version > stateSnapshotVersion {
+		return fmt.Errorf("%w: %d", ErrSnapshotVersion, snap.Version)
+	}
+	if own := s.NodeInfo().GetMyNodeNum(); own != 0 && snap.NodeNum != own {
+		return fmt.Errorf("%w: snapshot of %s, state of %s", ErrSnapshotRadio, NodeID(snap.NodeNum), NodeID(own))
+	}
+
+	var myInfo *meshtastic.MyNodeInfo
+	var metadata *meshtastic.DeviceMetadata
+	var err error
+	if snap.MyInfo != nil {
+		myInfo = &meshtastic.MyNodeInfo{}
+		err = unmarshalJSON(snap.MyInfo, myInfo)
+	}
+	if err == nil && snap.Metadata != nil {
+		metadata = &meshtastic.DeviceMetadata{}
+		err = unmarshalJSON(snap.Metadata, metadata)
+	}
+	if err != nil {
+		return err
+	}
+	channels, err := unmarshalAll[*meshtastic.Channel](snap.Channels)
+	if err != nil {
+		return err
+	}
+	configs, err := unmarshalAll[*meshtastic.Config](snap.Configs)
+	if err != nil {
+		return err
+	}
+	modules, err := unmarshalAll[*meshtastic.ModuleConfig](snap.Modules)
+	if err != nil {
+		return err
+	}
+	nodes := make([]*Node, 0, len(snap.Nodes))
+	for _, n := range snap.Nodes {
+		node := &Node{Info: &meshtastic.NodeInfo{}, RSSI: n.RSSI}
+		if err := unmarshalJSON(n.Info, node.Info); err != nil {
+			return err
+		}
+		nodes = append(nodes, node)
+	}
+
+	s.Lock()
+	s.nodeInfo = myInfo
+	s.deviceMetadata = metadata
+	s.channels = channels
+	s.configs = configs
+	s.modules = modules
+	s.rebuildLocal()
+	s.changes.Add(1)
+	s.Unlock()
+	s.nodes.restore(nodes)
+	return nil
+}
+
+// Save writes a snapshot of the state to path. The file is replaced atomically, so a crash while
+// saving leaves the previous snapshot intact.
+func (s *State) Save(path string) error {
+	data, err := s.Snapshot()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("saving state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+	return nil
+}
+
+// Load restores the state from a snapshot file written by Save. A missing file is reported as fs.ErrNotExist.
+func (s *State) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("loading state: %w", err)
+	}
+	return s.Restore(data)
+}
+
+// restore replaces the nodes of db.
+func (db *NodeDB) restore(nodes []*Node) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.nodes = make(map[uint32]*Node, len(nodes))
+	for _, node := range nodes {
+		db.nodes[node.Info.GetNum()] = node
+	}
+	db.changes.Add(1)
+}
+
+// marshalAll encodes msgs as protobuf JSON.
+func marshalAll[T proto.Message](msgs []T) ([]json.RawMessage, error) {
+	out := make([]json.RawMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		data, err := protojson.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data)
+	}
+	return out, nil
+}
+
+// unmarshalAll decodes protobuf JSON into messages of type T.
+func unmarshalAll[T proto.Message](raw []json.RawMessage) ([]T, error) {
+	out := make([]T, 0, len(raw))
+	for _, data := range raw {
+		var kind T
+		msg := kind.ProtoReflect().New().Interface().(T)
+		if err := unmarshalJSON(data, msg); err != nil {
+			return nil, err
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
+
+// unmarshalJSON decodes protobuf JSON into msg, skipping fields unknown to this version.
+func unmarshalJSON(data []byte, msg proto.Message) error {
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("decoding %s from state snapshot: %w", proto.MessageName(msg), err)
+	}
+	return nil
+}
+
+// loadState restores the State from StateFile. A missing or unreadable snapshot leaves the State empty.
+func (c *Client) loadState() {
+	err := c.State.Load(c.StateFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		c.log.Debug("no state snapshot yet", "path", c.StateFile)
+	case err != nil:
+		c.log.Warn("ignoring state snapshot", "path", c.StateFile, "err", err)
+	default:
+		c.log.Info("restored state snapshot", "path", c.StateFile, "nodes", c.State.nodes.Len())
+	}
+	c.stateSave.Lock()
+	c.stateSave.saved = c.State.Changes()
+	c.stateSave.Unlock()
+}
+
+// saveState writes the State to StateFile if it changed since the last save.
+func (c *Client) saveState() {
+	c.stateSave.Lock()
+	defer c.stateSave.Unlock()
+	changes := c.State.Changes()
+	if changes == c.stateSave.saved {
+		return
+	}
+	if err := c.State.Save(c.StateFile); err != nil {
+		c.log.Error("saving state", "path", c.StateFile, "err", err)
+		return
+	}
+	c.stateSave.saved = changes
+}
+
+// stateSaveLoop saves the State every StateSaveInterval while it keeps changing, until the client is closed.
+func (c *Client) stateSaveLoop() {
+	ticker := time.NewTicker(c.StateSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.done:
+			c.saveState()
+			return
+		case <-ticker.C:
+			c.saveState()
+		}
+	}
+}
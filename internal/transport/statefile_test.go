@@ -0,0 +1,175 @@
+package transport_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStateSnapshotRoundTrip(t *testing.T) {
+	state := filledState(7)
+	data, err := state.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	var restored transport.State
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	if !proto.Equal(restored.NodeInfo(), state.NodeInfo()) {
+		t.Errorf("NodeInfo = %v, want %v", restored.NodeInfo(), state.NodeInfo())
+	}
+	if !proto.Equal(restored.DeviceMetadata(), state.DeviceMetadata()) {
+		t.Errorf("DeviceMetadata = %v, want %v", restored.DeviceMetadata(), state.DeviceMetadata())
+	}
+	equalAll(t, "channels", restored.Channels(), state.Channels())
+	equalAll(t, "configs", restored.Configs(), state.Configs())
+	equalAll(t, "modules", restored.Modules(), state.Modules())
+	equalAll(t, "nodes", restored.Nodes(), state.Nodes())
+	node, ok := restored.NodeDB().Get(8)
+	if !ok || node.RSSI != -70 {
+		t.Errorf("node 8 = %v, want RSSI -70", node)
+	}
+	if restored.Complete() {
+		t.Error("restored State is complete, want the download to be pending")
+	}
+}
+
+func TestStateRestoreRefused(t *testing.T) {
+	tests := []struct {
+		name string
+		// own is the node number the State holds before restoring; zero means none.
+		own     uint32
+		version int
+		wantErr error
+	}{
+		{name: "empty state", version: 1},
+		{name: "same radio", own: 7, version: 1},
+		{name: "other radio", own: 9, version: 1, wantErr: transport.ErrSnapshotRadio},
+		{name: "newer version", version: 2, wantErr: transport.ErrSnapshotVersion},
+		{name: "no version", version: 0, wantErr: transport.ErrSnapshotVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := filledState(7).Snapshot()
+			if err != nil {
+				t.Fatalf("Snapshot: %v", err)
+			}
+			data = withVersion(t, data, tt.version)
+			var state transport.State
+			if tt.own != 0 {
+				state.SetNodeInfo(&meshtastic.MyNodeInfo{MyNodeNum: tt.own})
+			}
+			err = state.Restore(data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Restore = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && state.NodeDB().Len() != 0 {
+				t.Errorf("refused Restore left %d nodes", state.NodeDB().Len())
+			}
+		})
+	}
+}
+
+func TestStateReconcile(t *testing.T) {
+	tests := []struct {
+		name string
+		// download is what the radio reports before completing the config download.
+		download     func(state *transport.State)
+		wantChannels int
+		wantConfigs  int
+	}{
+		{
+			name: "drops what the radio no longer has",
+			download: func(state *transport.State) {
+				state.AddChannel(&meshtastic.Channel{Index: 0, Role: meshtastic.Channel_PRIMARY})
+			},
+			wantChannels: 1,
+		},
+		{name: "keeps everything when nothing was reported", download: func(*transport.State) {}, wantChannels: 2, wantConfigs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := filledState(7).Snapshot()
+			if err != nil {
+				t.Fatalf("Snapshot: %v", err)
+			}
+			var state transport.State
+			if err := state.Restore(data); err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			tt.download(&state)
+			state.SetComplete(true)
+			if got := len(state.Channels()); got != tt.wantChannels {
+				t.Errorf("%d channels, want %d", got, tt.wantChannels)
+			}
+			if got := len(state.Configs()); got != tt.wantConfigs {
+				t.Errorf("%d configs, want %d", got, tt.wantConfigs)
+			}
+		})
+	}
+}
+
+func TestStateOtherRadio(t *testing.T) {
+	data, err := filledState(7).Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	var state transport.State
+	if err := state.Restore(data); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	state.SetNodeInfo(&meshtastic.MyNodeInfo{MyNodeNum: 9})
+	if n := state.NodeDB().Len(); n != 0 {
+		t.Errorf("%d nodes of the other radio kept, want 0", n)
+	}
+}
+
+// filledState returns a State of the radio own with nodes, channels, configs and modules.
+func filledState(own uint32) *transport.State {
+	state := &transport.State{}
+	state.SetNodeInfo(&meshtastic.MyNodeInfo{MyNodeNum: own, RebootCount: 3})
+	state.SetDeviceMetadata(&meshtastic.DeviceMetadata{FirmwareVersion: "2.5.0"})
+	state.AddNode(&meshtastic.NodeInfo{Num: own, User: &meshtastic.User{ShortName: "OWN"}})
+	state.AddNode(&meshtastic.NodeInfo{Num: 8, User: &meshtastic.User{ShortName: "EIGHT"}})
+	state.NodeDB().Update(&meshtastic.MeshPacket{From: 8, HopStart: 3, HopLimit: 3, RxRssi: -70, RxSnr: 5})
+	state.AddChannel(&meshtastic.Channel{Index: 0, Role: meshtastic.Channel_PRIMARY})
+	state.AddChannel(&meshtastic.Channel{Index: 1, Role: meshtastic.Channel_SECONDARY})
+	state.AddConfig(&meshtastic.Config{PayloadVariant: &meshtastic.Config_Lora{Lora: &meshtastic.Config_LoRaConfig{HopLimit: 3}}})
+	state.AddModule(&meshtastic.ModuleConfig{PayloadVariant: &meshtastic.ModuleConfig_Mqtt{Mqtt: &meshtastic.ModuleConfig_MQTTConfig{Enabled: true}}})
+	return state
+}
+
+// withVersion returns the snapshot data with its version replaced.
+func withVersion(t *testing.T, data []byte, version int) []byte {
+	t.Helper()
+	var snap map[string]any
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatal(err)
+	}
+	snap["version"] = version
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// equalAll fails the test unless got and want hold equal messages in the same order.
+func equalAll[T proto.Message](t *testing.T, what string, got, want []T) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d %s, want %d", len(got), what, len(want))
+	}
+	for i := range got {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("%s[%d] = %v, want %v", what, i, got[i], want[i])
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/protobuf/proto"
@@ -33,15 +34,27 @@ type StreamConn struct {
 	conn io.ReadWriteCloser
 	// DebugWriter is an optional writer that is used when a non-protobuf message is sent over the connection.
 	DebugWriter io.Writer
+	// Tap is an optional observer of every frame read and written, and of the non-protobuf bytes read.
+	// Set it before the connection is used.
+	Tap FrameTap
+	// WakeAfterIdle re-sends the wake preamble before a write when the link has carried no traffic for
+	// longer than this duration. Zero disables it.
+	WakeAfterIdle time.Duration
 
 	readMu  sync.Mutex
 	writeMu sync.Mutex
+	// debugPending collects non-framed bytes until a whole run can be handed to the Tap.
+	debugPending []byte
+	// lastRead and lastWrite hold the unix nano timestamps of the last complete frame in each direction.
+	lastRead  atomic.Int64
+	lastWrite atomic.Int64
+	stats     linkCounters
 }
 
 // NewClientStreamConn creates a new StreamConn with the provided io.ReadWriteCloser.
 // Once an io.ReadWriteCloser is provided, the StreamConn should be used read, write and close operations.
 func NewClientStreamConn(conn io.ReadWriteCloser) (*StreamConn, error) {
-	sConn := &StreamConn{conn: conn}
+	sConn := newStreamConn(conn)
 	if err := sConn.writeWake(); err != nil {
 		return nil, fmt.Errorf("sending wake message: %w", err)
 	}
@@ -51,7 +64,32 @@ func NewClientStreamConn(conn io.ReadWriteCloser) (*StreamConn, error) {
 // NewRadioStreamConn creates a new StreamConn with the provided io.ReadWriteCloser.
 // Once an io.ReadWriteCloser is provided, the StreamConn should be used read, write and close operations.
 func NewRadioStreamConn(conn io.ReadWriteCloser) *StreamConn {
-	return &StreamConn{conn: conn}
+	return newStreamConn(conn)
+}
+
+// newStreamConn creates a StreamConn whose idle clock starts now.
+func newStreamConn(conn io.ReadWriteCloser) *StreamConn {
+	sConn := &StreamConn{conn: conn}
+	now := time.Now().UnixNano()
+	sConn.lastRead.Store(now)
+	sConn.lastWrite.Store(now)
+	return sConn
+}
+
+// LastRead returns when the last complete frame was received.
+func (c *StreamConn) LastRead() time.Time {
+	return time.Unix(0, c.lastRead.Load())
+}
+
+// LastWrite returns when the last frame was sent.
+func (c *StreamConn) LastWrite() time.Time {
+	return time.Unix(0, c.lastWrite.Load())
+}
+
+// idleSince returns how long the link has carried no frames in either direction.
+func (c *StreamConn) idleSince(now time.Time) time.Duration {
+	last := max(c.lastRead.Load(), c.lastWrite.Load())
+	return now.Sub(time.Unix(0, last))
 }
 
 // Close closes the connection.
@@ -65,7 +103,17 @@ func (c *StreamConn) Read(out proto.Message) error {
 	if err != nil {
 		return err
 	}
-	return proto.Unmarshal(data, out)
+	if err := proto.Unmarshal(data, out); err != nil {
+		c.countDecodeError()
+		return err
+	}
+	return nil
+}
+
+// countDecodeError records a frame whose payload could not be unmarshalled.
+// Callers decoding the result of ReadBytes themselves report failures with it.
+func (c *StreamConn) countDecodeError() {
+	c.stats.decodeErrors.Add(1)
 }
 
 // ReadBytes reads a byte message from the connection.
@@ -80,26 +128,32 @@ func (c *StreamConn) ReadBytes() ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
+		c.stats.bytesIn.Add(1)
 
 		// Check for Start1.
 		if buf[0] != Start1 {
+			c.stats.debugBytes.Add(1)
 			if c.DebugWriter != nil {
 				if _, err := c.DebugWriter.Write(buf[0:1]); err != nil {
 					// Handle the error appropriately, e.g., log it
 					log.Printf("Failed to write to DebugWriter: %v", err)
 				}
 			}
+			c.tapDebug(buf[0])
 			continue
 		}
+		c.flushDebug()
 
 		// Read the second byte, looking for Start2.
 		_, err = io.ReadFull(c.conn, buf[1:2])
 		if err != nil {
 			return nil, err
 		}
+		c.stats.bytesIn.Add(1)
 
 		// Check for Start2.
 		if buf[1] != Start2 {
+			c.stats.resyncs.Add(1)
 			continue
 		}
 
@@ -108,20 +162,28 @@ func (c *StreamConn) ReadBytes() ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
+		c.stats.bytesIn.Add(2)
 
 		length := int(binary.BigEndian.Uint16(buf[2:]))
 		if length > PacketMTU {
 			//packet corrupt, start over
+			c.stats.oversize.Add(1)
 			continue
 		}
 		data := make([]byte, length)
 
 		// Read the protobuf data.
-		_, err = io.ReadFull(c.conn, data)
+		n, err := io.ReadFull(c.conn, data)
+		c.stats.bytesIn.Add(uint64(n))
 		if err != nil {
 			return nil, err
 		}
 
+		c.stats.framesIn.Add(1)
+		c.lastRead.Store(time.Now().UnixNano())
+		if c.Tap != nil {
+			c.Tap.Frame(CaptureIn, data)
+		}
 		return data, nil
 	}
 }
@@ -172,25 +234,66 @@ func (c *StreamConn) WriteBytes(data []byte) error {
 		return fmt.Errorf("data length exceeds uint16 max: %d > %d", dataLen, math.MaxUint16)
 	}
 
+	if c.WakeAfterIdle > 0 && c.idleSince(time.Now()) > c.WakeAfterIdle {
+		if err := c.writeWake(); err != nil {
+			return fmt.Errorf("sending wake message: %w", err)
+		}
+	}
+
+	start := time.Now()
 	if err := writeStreamHeader(c.conn, uint16(dataLen)); err != nil {
+		c.stats.writeErrors.Add(1)
 		return fmt.Errorf("writing stream header: %w", err)
 	}
+	c.stats.bytesOut.Add(4)
 
-	if _, err := c.conn.Write(data); err != nil {
+	n, err := c.conn.Write(data)
+	c.stats.bytesOut.Add(uint64(n))
+	if err != nil {
+		c.stats.writeErrors.Add(1)
 		return fmt.Errorf("writing proto message: %w", err)
 	}
+	now := time.Now()
+	c.stats.wrote(now.Sub(start))
+	c.lastWrite.Store(now.UnixNano())
+	if c.Tap != nil {
+		c.Tap.Frame(CaptureOut, data)
+	}
 	return nil
 }
 
+// maxDebugRun is the number of non-framed bytes collected before they are handed to the Tap.
+const maxDebugRun = 256
+
+// tapDebug collects a non-framed byte for the Tap, flushing at line ends.
+func (c *StreamConn) tapDebug(b byte) {
+	if c.Tap == nil {
+		return
+	}
+	c.debugPending = append(c.debugPending, b)
+	if b == '\n' || len(c.debugPending) >= maxDebugRun {
+		c.flushDebug()
+	}
+}
+
+// flushDebug hands the collected non-framed bytes to the Tap.
+func (c *StreamConn) flushDebug() {
+	if c.Tap == nil || len(c.debugPending) == 0 {
+		return
+	}
+	c.Tap.Frame(CaptureDebug, c.debugPending)
+	c.debugPending = c.debugPending[:0]
+}
+
 // writeWake writes a wake message to the radio.
-// This should only be called on the client side.
-//
-// TODO: Rather than just sending this on start, do we need to also send this after a long period of inactivity?
+// This should only be called on the client side. Besides on start it is sent again before a write
+// once the link has been idle for longer than WakeAfterIdle.
 func (c *StreamConn) writeWake() error {
 	// Send 32 bytes of Start2 to wake the radio if sleeping.
-	_, err := c.conn.Write(
+	n, err := c.conn.Write(
 		bytes.Repeat([]byte{Start2}, 32),
 	)
+	c.stats.bytesOut.Add(uint64(n))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,208 @@
+package transport
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// BroadcastAddr is the destination node number of packets sent to everyone.
+	BroadcastAddr = 0xffffffff
+	// DefaultSubscriptionBuffer is the channel buffer of a subscription when SubscribeOptions.Buffer is zero.
+	DefaultSubscriptionBuffer = 64
+)
+
+// Delivery selects packets by how they were addressed.
+type Delivery int
+
+const (
+	// DeliveryAny matches direct and broadcast packets.
+	DeliveryAny Delivery = iota
+	// DeliveryDirect matches packets addressed to a single node.
+	DeliveryDirect
+	// DeliveryBroadcast matches packets addressed to BroadcastAddr.
+	DeliveryBroadcast
+)
+
+// PacketFilter selects the packets a subscription receives. Zero fields match everything.
+type PacketFilter struct {
+	// PortNums restricts the subscription to decoded packets on these ports.
+	PortNums []meshtastic.PortNum
+	// From restricts the subscription to packets sent by this node.
+	From uint32
+	// To restricts the subscription to packets addressed to this node.
+	To uint32
+	// Channel restricts the subscription to packets on this channel index.
+	Channel *uint32
+	// Delivery restricts the subscription to direct or broadcast packets.
+	Delivery Delivery
+}
+
+// Match reports whether packet passes the filter.
+func (f PacketFilter) Match(packet *meshtastic.MeshPacket) bool {
+	if len(f.PortNums) > 0 && (packet.GetDecoded() == nil || !slices.Contains(f.PortNums, packet.GetDecoded().GetPortnum())) {
+		return false
+	}
+	if f.From != 0 && packet.GetFrom() != f.From {
+		return false
+	}
+	if f.To != 0 && packet.GetTo() != f.To {
+		return false
+	}
+	if f.Channel != nil && packet.GetChannel() != *f.Channel {
+		return false
+	}
+	switch f.Delivery {
+	case DeliveryDirect:
+		return packet.GetTo() != BroadcastAddr
+	case DeliveryBroadcast:
+		return packet.GetTo() == BroadcastAddr
+	}
+	return true
+}
+
+// SubscribeOptions configures the buffering of a subscription.
+type SubscribeOptions struct {
+	// Buffer is the channel capacity. Zero means DefaultSubscriptionBuffer.
+	Buffer int
+	// Overflow is applied when the channel is full. OverflowBlock holds up the read loop until the subscriber catches up.
+	Overflow Overflow
+}
+
+// PacketEvent is a packet delivered to a subscription.
+type PacketEvent struct {
+	Packet *meshtastic.MeshPacket
+	// Payload is the decoded payload for ports carrying a protobuf message, see DecodePayload.
+	Payload proto.Message
+	// Err is set when the payload could not be decoded.
+	Err error
+	// Annotations holds the values middlewares attached to the packet.
+	Annotations Annotations
+}
+
+// Text returns the payload of a text message.
+func (e PacketEvent) Text() string {
+	if e.Packet.GetDecoded().GetPortnum() != meshtastic.PortNum_TEXT_MESSAGE_APP {
+		return ""
+	}
+	return string(e.Packet.GetDecoded().GetPayload())
+}
+
+// subscriber is a single Subscribe call.
+type subscriber struct {
+	ctx    context.Context
+	filter PacketFilter
+	opts   SubscribeOptions
+	mu     sync.Mutex
+	ch     chan PacketEvent
+	closed bool
+}
+
+// subscriptions is the set of active subscribers of a Client.
+type subscriptions struct {
+	mu      sync.RWMutex
+	subs    map[*subscriber]struct{}
+	dropped atomic.Uint64
+}
+
+// Subscribe returns a channel receiving every packet matching filter. The channel is closed once ctx is done
+// or the client is closed. An optional SubscribeOptions sets the buffer size and the overflow behavior.
+func (c *Client) Subscribe(ctx context.Context, filter PacketFilter, opts ...SubscribeOptions) <-chan PacketEvent {
+	var o SubscribeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Buffer <= 0 {
+		o.Buffer = DefaultSubscriptionBuffer
+	}
+	sub := &subscriber{ctx: ctx, filter: filter, opts: o, ch: make(chan PacketEvent, o.Buffer)}
+
+	c.subs.mu.Lock()
+	if c.subs.subs == nil {
+		c.subs.subs = make(map[*subscriber]struct{})
+	}
+	c.subs.subs[sub] = struct{}{}
+	c.subs.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.ctx.Done():
+		}
+		c.subs.mu.Lock()
+		delete(c.subs.subs, sub)
+		c.subs.mu.Unlock()
+		sub.mu.Lock()
+		sub.closed = true
+		close(sub.ch)
+		sub.mu.Unlock()
+	}()
+	return sub.ch
+}
+
+// publish delivers packet to every matching subscriber.
+func (s *subscriptions) publish(ctx context.Context, packet *meshtastic.MeshPacket) {
+	s.mu.RLock()
+	var matched []*subscriber
+	for sub := range s.subs {
+		if sub.filter.Match(packet) {
+			matched = append(matched, sub)
+		}
+	}
+	s.mu.RUnlock()
+	if len(matched) == 0 {
+		return
+	}
+
+	event := PacketEvent{Packet: packet, Annotations: AnnotationsFrom(ctx)}
+	if packet.GetDecoded() != nil {
+		event.Payload, event.Err = DecodePayload(packet.GetDecoded())
+	}
+	for _, sub := range matched {
+		if !sub.send(ctx, event) {
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// send delivers event according to the subscriber's overflow policy and reports whether nothing was dropped.
+func (sub *subscriber) send(ctx context.Context, event PacketEvent) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return true
+	}
+	select {
+	case sub.ch <- event:
+		return true
+	default:
+	}
+	switch sub.opts.Overflow {
+	case OverflowDropNewest:
+		return false
+	case OverflowDropOldest:
+		select {
+		case <-sub.ch:
+		default:
+		}
+		select {
+		case sub.ch <- event:
+		default:
+		}
+		return false
+	default:
+		select {
+		case sub.ch <- event:
+			return true
+		case <-sub.ctx.Done():
+		case <-ctx.Done():
+		}
+		return false
+	}
+}
@@ -0,0 +1,84 @@
+package transport_test
+
+import (
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+func TestPacketFilterMatch(t *testing.T) {
+	channel := func(index uint32) *uint32 { return &index }
+	text := &meshtastic.MeshPacket{
+		From:           7,
+		To:             transport.BroadcastAddr,
+		Channel:        1,
+		PayloadVariant: &meshtastic.MeshPacket_Decoded{Decoded: &meshtastic.Data{Portnum: meshtastic.PortNum_TEXT_MESSAGE_APP}},
+	}
+	direct := &meshtastic.MeshPacket{
+		From:           8,
+		To:             9,
+		PayloadVariant: &meshtastic.MeshPacket_Decoded{Decoded: &meshtastic.Data{Portnum: meshtastic.PortNum_POSITION_APP}},
+	}
+	encrypted := &meshtastic.MeshPacket{From: 7, To: 9, PayloadVariant: &meshtastic.MeshPacket_Encrypted{Encrypted: []byte{1}}}
+	tests := []struct {
+		name   string
+		filter transport.PacketFilter
+		packet *meshtastic.MeshPacket
+		want   bool
+	}{
+		{name: "zero filter", packet: text, want: true},
+		{name: "from", filter: transport.PacketFilter{From: 7}, packet: text, want: true},
+		{name: "from other node", filter: transport.PacketFilter{From: 8}, packet: text},
+		{name: "to", filter: transport.PacketFilter{To: 9}, packet: direct, want: true},
+		{name: "to other node", filter: transport.PacketFilter{To: 9}, packet: text},
+		{name: "channel", filter: transport.PacketFilter{Channel: channel(1)}, packet: text, want: true},
+		{name: "other channel", filter: transport.PacketFilter{Channel: channel(0)}, packet: text},
+		{name: "primary channel", filter: transport.PacketFilter{Channel: channel(0)}, packet: direct, want: true},
+		{name: "port", filter: transport.PacketFilter{PortNums: []meshtastic.PortNum{meshtastic.PortNum_TEXT_MESSAGE_APP}}, packet: text, want: true},
+		{
+			name:   "one of several ports",
+			filter: transport.PacketFilter{PortNums: []meshtastic.PortNum{meshtastic.PortNum_TEXT_MESSAGE_APP, meshtastic.PortNum_POSITION_APP}},
+			packet: direct,
+			want:   true,
+		},
+		{name: "other port", filter: transport.PacketFilter{PortNums: []meshtastic.PortNum{meshtastic.PortNum_POSITION_APP}}, packet: text},
+		{name: "port of encrypted packet", filter: transport.PacketFilter{PortNums: []meshtastic.PortNum{meshtastic.PortNum_TEXT_MESSAGE_APP}}, packet: encrypted},
+		{name: "direct", filter: transport.PacketFilter{Delivery: transport.DeliveryDirect}, packet: direct, want: true},
+		{name: "direct rejects broadcast", filter: transport.PacketFilter{Delivery: transport.DeliveryDirect}, packet: text},
+		{name: "broadcast", filter: transport.PacketFilter{Delivery: transport.DeliveryBroadcast}, packet: text, want: true},
+		{name: "broadcast rejects direct", filter: transport.PacketFilter{Delivery: transport.DeliveryBroadcast}, packet: direct},
+		{
+			name:   "all fields",
+			filter: transport.PacketFilter{From: 7, To: transport.BroadcastAddr, Channel: channel(1), PortNums: []meshtastic.PortNum{meshtastic.PortNum_TEXT_MESSAGE_APP}, Delivery: transport.DeliveryBroadcast},
+			packet: text,
+			want:   true,
+		},
+		{
+			name:   "all fields but one",
+			filter: transport.PacketFilter{From: 7, To: transport.BroadcastAddr, Channel: channel(2), PortNums: []meshtastic.PortNum{meshtastic.PortNum_TEXT_MESSAGE_APP}},
+			packet: text,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.packet); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	radio := newRadio(t, fakeradio.Config{})
+	c := newClient(t, radio)
+	connect(t, c)
+	sub := c.Subscribe(testContext(t), transport.PacketFilter{From: 7})
+
+	radio.Inject(&meshtastic.MeshPacket{From: 8, Id: 1})
+	radio.Inject(&meshtastic.MeshPacket{From: 7, Id: 2})
+	if got := waitFor(t, sub, "the subscription").Packet.GetId(); got != 2 {
+		t.Errorf("subscription received packet %d, want 2", got)
+	}
+}
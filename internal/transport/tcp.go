@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTCPPort is the port the firmware listens on for stream API clients.
+	DefaultTCPPort = 4403
+	// DefaultDialTimeout is used by DialTCP when TCPOptions.DialTimeout is zero.
+	DefaultDialTimeout = 10 * time.Second
+	// DefaultKeepAlive is used by DialTCP when TCPOptions.KeepAlive is zero.
+	DefaultKeepAlive = 30 * time.Second
+)
+
+// TCPOptions configures how DialTCP connects to a network-attached radio.
+type TCPOptions struct {
+	// DialTimeout bounds how long establishing the connection may take.
+	DialTimeout time.Duration
+	// KeepAlive is the TCP keepalive period. A negative value disables keepalives.
+	KeepAlive time.Duration
+}
+
+// tcpConn wraps a TCP connection so that Close half-closes the write side first,
+// giving the radio a clean FIN before the socket is torn down.
+type tcpConn struct {
+	*net.TCPConn
+}
+
+// Close shuts down the write side of the connection and then closes it.
+func (c tcpConn) Close() error {
+	_ = c.CloseWrite()
+	return c.TCPConn.Close()
+}
+
+// TCPAddress returns host with DefaultTCPPort appended when it does not already carry a port.
+func TCPAddress(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(DefaultTCPPort))
+}
+
+// DialTCP connects to a radio over TCP and returns a StreamConn speaking the stream protocol on it.
+// The host may omit the port, in which case DefaultTCPPort is used.
+func DialTCP(ctx context.Context, host string, opts TCPOptions) (*StreamConn, error) {
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = DefaultDialTimeout
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	dialer := net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: opts.KeepAlive,
+	}
+	addr := TCPAddress(host)
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", addr, err)
+	}
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unexpected connection type %T", conn)
+	}
+	sc, err := NewClientStreamConn(tcpConn{tc})
+	if err != nil {
+		_ = tc.Close()
+		return nil, err
+	}
+	return sc, nil
+}
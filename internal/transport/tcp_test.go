@@ -0,0 +1,94 @@
+package transport_test
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/patrikcze/meshtastic_go/internal/fakeradio"
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	meshtastic "github.com/patrikcze/meshtastic_go/pkg/generated"
+)
+
+func TestTCPAddress(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "meshtastic.local", want: "meshtastic.local:4403"},
+		{host: "192.168.1.20", want: "192.168.1.20:4403"},
+		{host: "192.168.1.20:4404", want: "192.168.1.20:4404"},
+		{host: "::1", want: "[::1]:4403"},
+		{host: "[::1]", want: "[::1]:4403"},
+		{host: "[::1]:4404", want: "[::1]:4404"},
+		{host: "", want: ":4403"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := transport.TCPAddress(tt.host); got != tt.want {
+				t.Errorf("TCPAddress(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialTCP(t *testing.T) {
+	tests := []struct {
+		name string
+		// addr is where the radio listens, host what is dialed; an empty host dials the listener's address.
+		addr, host string
+	}{
+		{name: "explicit port", addr: "127.0.0.1:0"},
+		{name: "default port", addr: "127.0.0.1:" + strconv.Itoa(transport.DefaultTCPPort), host: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", tt.addr)
+			if err != nil {
+				t.Skipf("cannot listen on %s: %v", tt.addr, err)
+			}
+			t.Cleanup(func() { _ = ln.Close() })
+			radio := newRadio(t, fakeradio.Config{MyInfo: &meshtastic.MyNodeInfo{MyNodeNum: radioA}})
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				_ = radio.Serve(conn)
+			}()
+
+			host := tt.host
+			if host == "" {
+				host = ln.Addr().String()
+			}
+			sc, err := transport.DialTCP(testContext(t), host, transport.TCPOptions{})
+			if err != nil {
+				t.Fatalf("DialTCP(%q): %v", host, err)
+			}
+			c := transport.NewClient(sc, false)
+			t.Cleanup(func() {
+				_ = c.Close()
+				c.Wait()
+			})
+			connect(t, c)
+			if got := c.State.NodeInfo().GetMyNodeNum(); got != radioA {
+				t.Errorf("connected to radio %s, want %s", transport.NodeID(got), transport.NodeID(radioA))
+			}
+		})
+	}
+}
+
+func TestDialTCPRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	_, err = transport.DialTCP(testContext(t), addr, transport.TCPOptions{})
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		t.Errorf("DialTCP to a closed port = %v, want a dial error", err)
+	}
+}
@@ -0,0 +1,456 @@
+// Package meshtastic is the public client API for Meshtastic radios attached over USB serial or TCP.
+//
+// A Client connects to the radio, downloads its config into State, sends packets through a queue
+// that honors the radio's TX buffer, hands received messages to typed handlers and subscriptions,
+// and exposes the admin requests of the local node. It reconnects on its own when the link dies.
+//
+//	client := meshtastic.New(meshtastic.SerialDialer("", meshtastic.SerialOptions{}))
+//	meshtastic.OnText(client, func(packet *generated.MeshPacket, text string) { ... })
+//	if err := client.Connect(ctx); err != nil { ... }
+//	defer client.Close()
+//	_, err := client.SendText(ctx, meshtastic.BroadcastAddr, 0, "hello mesh")
+//
+// The protobuf messages are in github.com/patrikcze/meshtastic_go/pkg/generated.
+package meshtastic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/patrikcze/meshtastic_go/internal/transport"
+	generated "github.com/patrikcze/meshtastic_go/pkg/generated"
+	"github.com/patrikcze/meshtastic_go/pkg/serial"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// Client is a connection to a Meshtastic radio. See the package documentation.
+	Client = transport.Client
+	// State is what the client learned about the radio during the config download.
+	State = transport.State
+	// StreamConn speaks the stream protocol of the client API on a serial port or TCP connection.
+	StreamConn = transport.StreamConn
+	// DialFunc opens a fresh link to the radio.
+	DialFunc = transport.DialFunc
+	// Backoff describes the delay between reconnect attempts.
+	Backoff = transport.Backoff
+	// TCPOptions configures connections to network-attached radios.
+	TCPOptions = transport.TCPOptions
+
+	// Event is a link or packet event delivered through Client.Events.
+	Event = transport.Event
+	// EventType names an Event.
+	EventType = transport.EventType
+	// EventHandler handles an Event.
+	EventHandler = transport.EventHandler
+	// ExecPolicy describes how a handler is scheduled.
+	ExecPolicy = transport.ExecPolicy
+	// ExecMode selects how calls to a handler are scheduled.
+	ExecMode = transport.ExecMode
+	// Overflow selects what happens when a handler or subscription queue is full.
+	Overflow = transport.Overflow
+
+	// PacketFilter selects the packets a subscription receives.
+	PacketFilter = transport.PacketFilter
+	// SubscribeOptions configures the buffering of a subscription.
+	SubscribeOptions = transport.SubscribeOptions
+	// PacketEvent is a packet delivered to a subscription.
+	PacketEvent = transport.PacketEvent
+	// Delivery selects packets by how they were addressed.
+	Delivery = transport.Delivery
+
+	// Middleware wraps the inbound and outbound message pipelines of a Client.
+	Middleware = transport.Middleware
+	// MiddlewareFuncs adapts a pair of functions to Middleware.
+	MiddlewareFuncs = transport.MiddlewareFuncs
+	// InboundFunc processes a message received from the radio.
+	InboundFunc = transport.InboundFunc
+	// OutboundFunc processes a message on its way to the radio.
+	OutboundFunc = transport.OutboundFunc
+	// Metrics counts messages passing through the pipeline.
+	Metrics = transport.Metrics
+	// MetricsSnapshot holds the counters of a Metrics at one point in time.
+	MetricsSnapshot = transport.MetricsSnapshot
+	// Annotations holds values middlewares attached to a message, see Annotate.
+	Annotations = transport.Annotations
+
+	// RoutingError is returned when the mesh answers a packet with a Routing error.
+	RoutingError = transport.RoutingError
+	// QueueError is returned when the radio refused a packet on every attempt.
+	QueueError = transport.QueueError
+	// QueueStats is a snapshot of the outbound send queue.
+	QueueStats = transport.QueueStats
+	// LinkStats is a snapshot of the health counters of a link.
+	LinkStats = transport.LinkStats
+	// NodeDB holds the nodes of the mesh keyed by node number, see State.NodeDB.
+	NodeDB = transport.NodeDB
+	// Node is an entry of the NodeDB.
+	Node = transport.Node
+	// Manager runs a Client per radio and merges what they receive.
+	Manager = transport.Manager
+	// RadioPacket is a packet together with the radio of a Manager it was received by.
+	RadioPacket = transport.RadioPacket
+	// Server shares the radio of a Client with programs connecting over TCP, like a network-attached radio.
+	Server = transport.Server
+
+	// NodeChange is the Data of the node events, with the node before and after the change.
+	NodeChange = transport.NodeChange
+	// ChannelChange is the Data of EventChannelChanged.
+	ChannelChange = transport.ChannelChange
+	// ConfigChange is the Data of EventConfigChanged.
+	ConfigChange = transport.ConfigChange
+	// ModuleConfigChange is the Data of EventModuleConfigChanged.
+	ModuleConfigChange = transport.ModuleConfigChange
+	// MetadataChange is the Data of EventMetadataChanged.
+	MetadataChange = transport.MetadataChange
+	// MyInfoChange is the Data of EventMyInfoChanged.
+	MyInfoChange = transport.MyInfoChange
+
+	// LogSink receives the log records parsed from the device debug console.
+	LogSink = transport.LogSink
+	// DebugLogParser turns the device debug console into log records.
+	DebugLogParser = transport.DebugLogParser
+	// FrameTap observes the traffic of a link.
+	FrameTap = transport.FrameTap
+	// CaptureWriter records the traffic of a link to a capture file.
+	CaptureWriter = transport.CaptureWriter
+	// CaptureReader reads the records of a capture file.
+	CaptureReader = transport.CaptureReader
+	// CaptureRecord is a single entry of a capture file.
+	CaptureRecord = transport.CaptureRecord
+	// CaptureKind tells what a captured record holds.
+	CaptureKind = transport.CaptureKind
+	// ReplayOptions configures how a capture is played back.
+	ReplayOptions = transport.ReplayOptions
+	// ReplayConn plays a capture back as if it were the radio.
+	ReplayConn = transport.ReplayConn
+
+	// SerialPort is a USB serial port recognized as a radio.
+	SerialPort = serial.Port
+	// SerialRule recognizes a USB serial port as a radio by VID, PID or serial number.
+	SerialRule = serial.Rule
+	// SerialWatcher reports USB radios being attached and detached.
+	SerialWatcher = serial.Watcher
+	// SerialChange is a USB radio being attached or detached.
+	SerialChange = serial.Change
+	// SerialOptions configures the line settings of a serial port: speed, framing, the DTR and RTS
+	// states at open and the read timeout. The zero value is 115200 8N1.
+	SerialOptions = serial.Options
+	// SerialLine is the state of a control line when the port is opened.
+	SerialLine = serial.Line
+)
+
+const (
+	// BroadcastAddr is the destination of packets sent to everyone.
+	BroadcastAddr = transport.BroadcastAddr
+
+	// EventMeshPacketReceived is dispatched for every packet passed on to the handlers.
+	EventMeshPacketReceived = transport.EventMeshPacketReceived
+	// EventDisconnected is dispatched when the link to the radio is lost.
+	EventDisconnected = transport.EventDisconnected
+	// EventReconnected is dispatched when the link has been re-established.
+	EventReconnected = transport.EventReconnected
+	// EventNodeUpdated is dispatched when a received packet updated the node database.
+	EventNodeUpdated = transport.EventNodeUpdated
+	// EventNodeAdded, EventNodeRenamed and EventNodeMoved are dispatched when the node database changes.
+	EventNodeAdded   = transport.EventNodeAdded
+	EventNodeRenamed = transport.EventNodeRenamed
+	EventNodeMoved   = transport.EventNodeMoved
+	// EventChannelChanged, EventConfigChanged, EventModuleConfigChanged and EventMetadataChanged are dispatched
+	// when the radio reports a different channel, config or device metadata than the State held.
+	EventChannelChanged      = transport.EventChannelChanged
+	EventConfigChanged       = transport.EventConfigChanged
+	EventModuleConfigChanged = transport.EventModuleConfigChanged
+	EventMetadataChanged     = transport.EventMetadataChanged
+	// EventMyInfoChanged is dispatched when the radio reports different node info for the local node.
+	EventMyInfoChanged = transport.EventMyInfoChanged
+
+	ExecConcurrent = transport.ExecConcurrent
+	ExecSequential = transport.ExecSequential
+	ExecPool       = transport.ExecPool
+	ExecPerSender  = transport.ExecPerSender
+
+	OverflowBlock      = transport.OverflowBlock
+	OverflowDropOldest = transport.OverflowDropOldest
+	OverflowDropNewest = transport.OverflowDropNewest
+
+	CaptureIn    = transport.CaptureIn
+	CaptureOut   = transport.CaptureOut
+	CaptureDebug = transport.CaptureDebug
+
+	DeliveryAny       = transport.DeliveryAny
+	DeliveryDirect    = transport.DeliveryDirect
+	DeliveryBroadcast = transport.DeliveryBroadcast
+
+	SerialAttached = serial.Attached
+	SerialDetached = serial.Detached
+
+	SerialLineDefault = serial.LineDefault
+	SerialLineOn      = serial.LineOn
+	SerialLineOff     = serial.LineOff
+)
+
+// The errors returned by the client. They are the same values as used internally, so errors.Is works on them.
+var (
+	ErrClosed        = transport.ErrClosed
+	ErrTimeout       = transport.ErrTimeout
+	ErrNoResponse    = transport.ErrNoResponse
+	ErrNotConnected  = transport.ErrNotConnected
+	ErrDropped       = transport.ErrDropped
+	ErrNoRoute       = transport.ErrNoRoute
+	ErrGotNAK        = transport.ErrGotNAK
+	ErrMaxRetransmit = transport.ErrMaxRetransmit
+	ErrNoChannel     = transport.ErrNoChannel
+	ErrTooLarge      = transport.ErrTooLarge
+	ErrNotAuthorized = transport.ErrNotAuthorized
+	ErrBadCapture    = transport.ErrBadCapture
+
+	ErrRoutingTimeout   = transport.ErrRoutingTimeout
+	ErrNoAppResponse    = transport.ErrNoAppResponse
+	ErrDutyCycleLimit   = transport.ErrDutyCycleLimit
+	ErrPKIFailed        = transport.ErrPKIFailed
+	ErrPKIUnknownPubkey = transport.ErrPKIUnknownPubkey
+
+	ErrNoAnswerRequested = transport.ErrNoAnswerRequested
+
+	ErrSnapshotVersion   = transport.ErrSnapshotVersion
+	ErrSnapshotRadio     = transport.ErrSnapshotRadio
+	ErrUnknownRadio      = transport.ErrUnknownRadio
+	ErrDuplicateRadio    = transport.ErrDuplicateRadio
+	ErrSerialPortBusy    = serial.ErrPortBusy
+	ErrSerialReadTimeout = serial.ErrReadTimeout
+)
+
+// SerialNoReset returns SerialOptions which keep ESP32 boards from rebooting when the port is opened.
+func SerialNoReset() SerialOptions {
+	return serial.NoReset()
+}
+
+// DefaultBackoff returns the reconnect backoff of new clients.
+func DefaultBackoff() Backoff {
+	return transport.DefaultBackoff
+}
+
+// DefaultSerialBaudRate is the speed serial ports are opened at unless SerialOptions.BaudRate is set.
+const DefaultSerialBaudRate = serial.DefaultBaudRate
+
+// DefaultStateSaveInterval is how often new clients check whether their State needs saving to Client.StateFile.
+const DefaultStateSaveInterval = transport.DefaultStateSaveInterval
+
+// New creates a client which opens its link with dial and re-dials when the link dies.
+func New(dial DialFunc) *Client {
+	return transport.NewDialClient(dial, false)
+}
+
+// NewManager creates a Manager without radios. Add a client per radio with Manager.Add.
+func NewManager() *Manager {
+	return transport.NewManager()
+}
+
+// NewServer creates a Server sharing the radio of c. Call it before c connects, then Server.ListenAndServe.
+func NewServer(c *Client) *Server {
+	return transport.NewServer(c)
+}
+
+// NewClient creates a client on an already open link. The client stops for good when the link dies.
+func NewClient(sc *StreamConn) *Client {
+	return transport.NewClient(sc, false)
+}
+
+// NodeID returns the "!hex" form of a node number, such as !0fa4e001.
+func NodeID(num uint32) string {
+	return transport.NodeID(num)
+}
+
+// ParseNodeID parses a decimal node number or a "!hex" node ID, the form NodeID returns.
+func ParseNodeID(id string) (uint32, error) {
+	return transport.ParseNodeID(id)
+}
+
+// SerialPorts returns the USB serial ports recognized as a radio by rules or by the built-in table
+// of known boards, see serial.KnownDevices.
+func SerialPorts(rules ...SerialRule) ([]SerialPort, error) {
+	return serial.GetPorts(rules...)
+}
+
+// LoadSerialRules reads SerialRules from a JSON file, see serial.LoadRules.
+func LoadSerialRules(path string) ([]SerialRule, error) {
+	return serial.LoadRules(path)
+}
+
+// SerialDialer returns a DialFunc which opens the serial port with opts. An empty port picks the first of SerialPorts,
+// recognized with rules. After the first dial it follows the radio it opened by its SerialPort.Key, so the
+// client reconnects to it when it comes back under a different name after being unplugged, reset or flashed.
+// A radio without a USB serial number is only found again on the same port, see SerialPort.Stable.
+func SerialDialer(port string, opts SerialOptions, rules ...SerialRule) DialFunc {
+	var mu sync.Mutex
+	var last string
+	return transport.StreamDialer(func() (io.ReadWriteCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ports, err := serial.GetPorts(rules...)
+		path := port
+		for _, p := range ports {
+			if last != "" && p.Key() == last {
+				path = p.Name
+			}
+		}
+		if path == "" {
+			if err != nil {
+				return nil, err
+			}
+			if len(ports) == 0 {
+				return nil, errors.New("no suitable USB serial ports found")
+			}
+			path = ports[0].Name
+		}
+		conn, err := serial.Open(path, opts)
+		if err != nil {
+			return nil, fmt.Errorf("opening serial port %s: %w", path, err)
+		}
+		for _, p := range ports {
+			if p.Name == path {
+				last = p.Key()
+			}
+		}
+		return conn, nil
+	})
+}
+
+// SerialDeviceDialer returns a DialFunc which opens the USB radio with key, see SerialPort.Key, with opts on
+// whatever port it is attached to at the time of the dial. A client using it follows the radio when it is
+// re-enumerated under a different name after being unplugged, reset or flashed. The key of a radio without
+// a USB serial number includes the port name, so such a radio is only found again on the same port.
+func SerialDeviceDialer(key string, opts SerialOptions, rules ...SerialRule) DialFunc {
+	return transport.StreamDialer(func() (io.ReadWriteCloser, error) {
+		port, ok, err := serial.FindPort(key, rules...)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("USB radio %s is not attached", key)
+		}
+		conn, err := serial.Open(port.Name, opts)
+		if err != nil {
+			return nil, fmt.Errorf("opening serial port %s: %w", port.Name, err)
+		}
+		return conn, nil
+	})
+}
+
+// NewSerialWatcher creates a watcher for USB radios recognized with rules, see SerialWatcher.Watch.
+func NewSerialWatcher(rules ...SerialRule) *SerialWatcher {
+	return serial.NewWatcher(rules...)
+}
+
+// TCPDialer returns a DialFunc which connects to a network-attached radio. The host may omit the port.
+func TCPDialer(host string, opts TCPOptions) DialFunc {
+	return transport.TCPDialer(host, opts)
+}
+
+// StreamDialer returns a DialFunc which wraps the link returned by open in a StreamConn.
+func StreamDialer(open func() (io.ReadWriteCloser, error)) DialFunc {
+	return transport.StreamDialer(open)
+}
+
+// OpenReplay opens a capture file to be played back in place of a radio, see NewClient and NewRadioStreamConn.
+func OpenReplay(path string, opts ReplayOptions) (*ReplayConn, error) {
+	return transport.OpenReplay(path, opts)
+}
+
+// NewRadioStreamConn speaks the stream protocol on conn without sending the wake preamble first.
+func NewRadioStreamConn(conn io.ReadWriteCloser) *StreamConn {
+	return transport.NewRadioStreamConn(conn)
+}
+
+// NewCaptureReader checks the capture header of r and returns a reader for its records.
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	return transport.NewCaptureReader(r)
+}
+
+// CreateCapture opens path for recording the traffic of a link, see Client.Tap.
+func CreateCapture(path string) (*CaptureWriter, error) {
+	return transport.CreateCapture(path)
+}
+
+// On registers fn for every message of type T received from the radio, such as *generated.QueueStatus.
+func On[T proto.Message](c *Client, fn func(T), policy ...ExecPolicy) {
+	transport.On(c, fn, policy...)
+}
+
+// OnPort registers fn for every decoded packet on port, with the payload unmarshalled into T.
+func OnPort[T proto.Message](c *Client, port generated.PortNum, fn func(packet *generated.MeshPacket, payload T), policy ...ExecPolicy) {
+	transport.OnPort(c, port, fn, policy...)
+}
+
+// OnPayload registers fn for every decoded packet whose port carries T, such as *generated.Position.
+func OnPayload[T proto.Message](c *Client, fn func(packet *generated.MeshPacket, payload T), policy ...ExecPolicy) {
+	transport.OnPayload(c, fn, policy...)
+}
+
+// OnText registers fn for every text message.
+func OnText(c *Client, fn func(packet *generated.MeshPacket, text string), policy ...ExecPolicy) {
+	transport.OnText(c, fn, policy...)
+}
+
+// NewDebugLogParser creates a parser for the device debug console, see Client.DebugWriter.
+func NewDebugLogParser(sinks ...LogSink) *DebugLogParser {
+	return transport.NewDebugLogParser(sinks...)
+}
+
+// NewMetrics creates a middleware counting messages, see Client.Use.
+func NewMetrics() *Metrics {
+	return transport.NewMetrics()
+}
+
+// SlogSink returns a LogSink which logs device log records to logger.
+func SlogSink(logger *slog.Logger) LogSink {
+	return transport.SlogSink(logger)
+}
+
+// WriterSink returns a LogSink which writes device log records to w as text lines.
+func WriterSink(w io.Writer) LogSink {
+	return transport.WriterSink(w)
+}
+
+// LogMiddleware logs every message in both directions at debug level.
+func LogMiddleware(logger *slog.Logger) Middleware {
+	return transport.LogMiddleware(logger)
+}
+
+// FilterMiddleware drops inbound messages for which keep returns false. The config download is always passed on.
+func FilterMiddleware(keep func(msg *generated.FromRadio) bool) Middleware {
+	return transport.FilterMiddleware(keep)
+}
+
+// Annotate attaches key and value to the message being processed with ctx, from within a middleware.
+func Annotate(ctx context.Context, key string, value any) {
+	transport.Annotate(ctx, key, value)
+}
+
+// AnnotationsFrom returns the annotations attached to the message being processed with ctx.
+func AnnotationsFrom(ctx context.Context) Annotations {
+	return transport.AnnotationsFrom(ctx)
+}
+
+// DecodePayload unmarshals the payload of data into the protobuf message its port carries.
+// It returns nil and no error for ports without a protobuf payload, such as text messages.
+func DecodePayload(data *generated.Data) (proto.Message, error) {
+	return transport.DecodePayload(data)
+}
+
+// DropOwnEchoes drops inbound packets sent by the local node.
+func DropOwnEchoes(state *State) Middleware {
+	return transport.DropOwnEchoes(state)
+}
+
+// DedupMiddleware drops inbound packets already seen within window.
+func DedupMiddleware(window time.Duration) Middleware {
+	return transport.DedupMiddleware(window)
+}
@@ -0,0 +1,61 @@
+//go:build unix
+
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// lockPort takes an advisory lock on port which is released by calling the returned function.
+// The lock is a file next to the other temporary files, named after the device the port path resolves
+// to, so /dev/ttyACM0 and its /dev/serial/by-id link share a lock. It is removed again on unlock, and the
+// kernel drops the lock when the process dies. Other programs are kept out by the exclusive mode the
+// port is opened in.
+func lockPort(port string) (func(), error) {
+	device := port
+	if resolved, err := filepath.EvalSymlinks(port); err == nil {
+		device = resolved
+	}
+	name := "meshtastic-" + strings.ReplaceAll(strings.TrimPrefix(device, "/"), "/", "_") + ".lock"
+	path := filepath.Join(os.TempDir(), name)
+	for {
+		// Read-only is enough for flock, and lets processes of other users lock a file they cannot write.
+		f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE|syscall.O_NOFOLLOW, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("locking %s: %w", port, err)
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			_ = f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, fmt.Errorf("%s: %w", port, ErrPortBusy)
+			}
+			return nil, fmt.Errorf("locking %s: %w", port, err)
+		}
+		// The previous holder may have removed the file between our open and flock, in which case the
+		// lock is on a file nobody else will find; start over with the current one.
+		if !samePath(f, path) {
+			_ = f.Close()
+			continue
+		}
+		return func() {
+			// Removed while still locked, so nobody can lock the file on its way out.
+			_ = os.Remove(path)
+			_ = f.Close()
+		}, nil
+	}
+}
+
+// samePath reports whether f is still the file at path.
+func samePath(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Lstat(path)
+	return err == nil && os.SameFile(opened, current)
+}
@@ -0,0 +1,52 @@
+//go:build unix
+
+package serial
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockPort(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	device := filepath.Join(t.TempDir(), "ttyUSB0")
+	if err := os.WriteFile(device, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(t.TempDir(), "by-id")
+	if err := os.Symlink(device, link); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := lockPort(device)
+	if err != nil {
+		t.Fatalf("lockPort: %v", err)
+	}
+	if _, err := lockPort(link); !errors.Is(err, ErrPortBusy) {
+		t.Fatalf("lockPort through a link to the locked device = %v, want ErrPortBusy", err)
+	}
+	locks, _ := filepath.Glob(filepath.Join(tmp, "meshtastic-*.lock"))
+	if len(locks) != 1 {
+		t.Fatalf("lock files %v, want one", locks)
+	}
+	info, err := os.Stat(locks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		t.Errorf("lock file mode = %v, want it writable by its owner only", info.Mode())
+	}
+
+	unlock()
+	if locks, _ := filepath.Glob(filepath.Join(tmp, "meshtastic-*.lock")); len(locks) != 0 {
+		t.Errorf("lock files %v left after unlock, want none", locks)
+	}
+	unlock, err = lockPort(link)
+	if err != nil {
+		t.Fatalf("lockPort after unlock: %v", err)
+	}
+	unlock()
+}
@@ -1,23 +1,206 @@
 package serial
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"go.bug.st/serial"
 )
 
 const (
-	portSpeed = 115200 //921600
-	dataBits  = 8
+	// DefaultBaudRate is the speed of the serial API of the radio firmware. Radios whose serial console
+	// is set to another speed, such as 921600, need Options.BaudRate.
+	DefaultBaudRate = 115200
+	// DefaultDataBits is the character size used unless Options.DataBits is set.
+	DefaultDataBits = 8
 )
 
-// Connect returns a list of available serial ports.
-func Connect(port string) (serial.Port, error) {
+var (
+	// ErrPortBusy is returned when the port is held by another process.
+	ErrPortBusy = errors.New("serial port is in use by another process")
+	// ErrReadTimeout is returned by a read of a port opened with Options.ReadTimeout when nothing arrived in time.
+	ErrReadTimeout = errors.New("no data from serial port within the read timeout")
+)
+
+type (
+	// Parity is the parity setting of the line.
+	Parity = serial.Parity
+	// StopBits is the stop bits setting of the line.
+	StopBits = serial.StopBits
+)
+
+const (
+	NoParity    = serial.NoParity
+	OddParity   = serial.OddParity
+	EvenParity  = serial.EvenParity
+	MarkParity  = serial.MarkParity
+	SpaceParity = serial.SpaceParity
+
+	OneStopBit           = serial.OneStopBit
+	OnePointFiveStopBits = serial.OnePointFiveStopBits
+	TwoStopBits          = serial.TwoStopBits
+)
+
+// Line is the state a modem control line is put in when the port is opened.
+type Line int
+
+const (
+	// LineDefault leaves the line as the operating system sets it on open, which is asserted.
+	LineDefault Line = iota
+	// LineOn asserts the line.
+	LineOn
+	// LineOff clears the line.
+	LineOff
+)
+
+// Options configures how a port is opened. The zero value opens the port at 115200 8N1 with the
+// control lines left alone, which is what the radio firmware expects.
+type Options struct {
+	// BaudRate is the speed of the line, DefaultBaudRate when zero.
+	BaudRate int
+	// DataBits is the character size, DefaultDataBits when zero.
+	DataBits int
+	Parity   Parity
+	StopBits StopBits
+	// DTR and RTS are the states of the control lines right after opening. Many ESP32 boards wire
+	// them to the reset and boot pins, so a radio which reboots whenever the port is opened should
+	// use NoReset, which clears both at once.
+	DTR, RTS Line
+	// ReadTimeout makes a read fail with ErrReadTimeout when nothing arrived for that long. A Client takes
+	// that as a lost link and reconnects, so it has to be longer than the radio may stay silent, which with
+	// the liveness probe of the Client is its HeartbeatInterval plus LivenessTimeout. Zero blocks until data arrives.
+	ReadTimeout time.Duration
+}
+
+// NoReset returns options which open the port at the default line settings with DTR and RTS cleared
+// together, which does not trigger the auto-reset circuit of ESP32 boards. The operating system still
+// raises both lines for a moment while opening, but an equal pulse on both does not reset the radio either.
+func NoReset() Options {
+	return Options{DTR: LineOff, RTS: LineOff}
+}
+
+// mode returns the line settings of o with the defaults filled in.
+func (o Options) mode() *serial.Mode {
 	mode := &serial.Mode{
-		BaudRate: portSpeed,
-		DataBits: dataBits,
+		BaudRate: o.BaudRate,
+		DataBits: o.DataBits,
+		Parity:   o.Parity,
+		StopBits: o.StopBits,
+	}
+	if mode.BaudRate == 0 {
+		mode.BaudRate = DefaultBaudRate
+	}
+	if mode.DataBits == 0 {
+		mode.DataBits = DefaultDataBits
+	}
+	if o.DTR != LineDefault || o.RTS != LineDefault {
+		// The library sets both lines at once, so a line left at its default is asserted like the OS does.
+		mode.InitialStatusBits = &serial.ModemOutputBits{DTR: o.DTR != LineOff, RTS: o.RTS != LineOff}
+	}
+	return mode
+}
+
+// Connect opens the serial port at 115200 8N1.
+func Connect(port string) (serial.Port, error) {
+	return Open(port, Options{})
+}
+
+// Open opens the serial port with opts. The port is opened exclusively and locked for as long as it is
+// open, and Open fails with ErrPortBusy when another process holds it.
+func Open(port string, opts Options) (serial.Port, error) {
+	unlock, err := lockPort(port)
+	if err != nil {
+		return nil, err
 	}
-	p, err := serial.Open(port, mode)
+	p, err := serial.Open(port, opts.mode())
 	if err != nil {
+		unlock()
+		var portErr *serial.PortError
+		if errors.As(err, &portErr) && portErr.Code() == serial.PortBusy {
+			return nil, fmt.Errorf("%s: %w", port, ErrPortBusy)
+		}
 		return nil, err
 	}
-	return p, nil
+	if opts.ReadTimeout > 0 {
+		if err := p.SetReadTimeout(opts.ReadTimeout); err != nil {
+			_ = p.Close()
+			unlock()
+			return nil, fmt.Errorf("setting read timeout: %w", err)
+		}
+		p = timeoutPort{Port: p}
+	}
+	return &lockedPort{Port: p, unlock: unlock}, nil
+}
+
+// timeoutPort turns the empty read the port returns when its read timeout expires into ErrReadTimeout,
+// so callers such as io.ReadFull do not retry it in a busy loop.
+type timeoutPort struct {
+	serial.Port
+}
+
+// Read reads from the port, failing with ErrReadTimeout when nothing arrived in time.
+func (p timeoutPort) Read(b []byte) (int, error) {
+	n, err := p.Port.Read(b)
+	if n == 0 && err == nil && len(b) > 0 {
+		return 0, ErrReadTimeout
+	}
+	return n, err
+}
+
+// lockedPort releases the lock of the port when it is closed.
+type lockedPort struct {
+	serial.Port
+	unlock func()
+}
+
+// Close closes the port and releases its lock.
+func (p *lockedPort) Close() error {
+	err := p.Port.Close()
+	p.unlock()
+	return err
+}
+
+// ParseParity parses a parity given as none, odd, even, mark or space, or by its first letter.
+func ParseParity(s string) (Parity, error) {
+	switch strings.ToLower(s) {
+	case "", "n", "none":
+		return NoParity, nil
+	case "o", "odd":
+		return OddParity, nil
+	case "e", "even":
+		return EvenParity, nil
+	case "m", "mark":
+		return MarkParity, nil
+	case "s", "space":
+		return SpaceParity, nil
+	}
+	return NoParity, fmt.Errorf("unknown parity %q", s)
+}
+
+// ParseStopBits parses 1, 1.5 or 2 stop bits.
+func ParseStopBits(s string) (StopBits, error) {
+	switch s {
+	case "", "1":
+		return OneStopBit, nil
+	case "1.5":
+		return OnePointFiveStopBits, nil
+	case "2":
+		return TwoStopBits, nil
+	}
+	return OneStopBit, fmt.Errorf("unknown stop bits %q", s)
+}
+
+// ParseLine parses the state of a control line given as on, off or default.
+func ParseLine(s string) (Line, error) {
+	switch strings.ToLower(s) {
+	case "", "default":
+		return LineDefault, nil
+	case "on", "1", "true", "high":
+		return LineOn, nil
+	case "off", "0", "false", "low":
+		return LineOff, nil
+	}
+	return LineDefault, fmt.Errorf("unknown line state %q, want on, off or default", s)
 }
@@ -0,0 +1,52 @@
+package serial
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"go.bug.st/serial"
+)
+
+// scriptedPort is a serial.Port whose reads return the given chunks, and then nothing as on a read timeout.
+type scriptedPort struct {
+	serial.Port
+	chunks [][]byte
+	reads  int
+}
+
+func (p *scriptedPort) Read(b []byte) (int, error) {
+	p.reads++
+	if len(p.chunks) == 0 {
+		return 0, nil
+	}
+	n := copy(b, p.chunks[0])
+	p.chunks = p.chunks[1:]
+	return n, nil
+}
+
+func TestTimeoutPort(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  [][]byte
+		want    int
+		wantErr error
+	}{
+		{name: "data in time", chunks: [][]byte{{1, 2}, {3, 4}}, want: 4},
+		{name: "silent port", wantErr: ErrReadTimeout},
+		{name: "partial data", chunks: [][]byte{{1, 2}}, want: 2, wantErr: ErrReadTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := &scriptedPort{chunks: tt.chunks}
+			n, err := io.ReadFull(timeoutPort{Port: port}, make([]byte, 4))
+			if n != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadFull = %d, %v, want %d, %v", n, err, tt.want, tt.wantErr)
+			}
+			// A timed-out read ends ReadFull instead of being retried.
+			if port.reads > len(tt.chunks)+1 {
+				t.Errorf("%d reads, want at most %d", port.reads, len(tt.chunks)+1)
+			}
+		})
+	}
+}
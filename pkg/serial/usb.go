@@ -1,50 +1,140 @@
 package serial
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
-	"github.com/charmbracelet/log"
 	/* trunk-ignore(golangci-lint/typecheck) */
 	"go.bug.st/serial/enumerator"
 )
 
-type usbDevice struct {
-	VID string
-	PID string
+// errNoCriteria is returned for rules which would match every port.
+var errNoCriteria = errors.New("rule needs a vid or serial_number")
+
+// Rule recognizes a USB serial port as a radio. Empty fields match anything, but a rule must set
+// at least the VID or the serial number. VID and PID are hex strings and compared ignoring case.
+type Rule struct {
+	VID          string `json:"vid,omitempty"`
+	PID          string `json:"pid,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	// Board and Chip describe the matched radio, such as "RAK4631" and "nRF52840".
+	Board string `json:"board,omitempty"`
+	Chip  string `json:"chip,omitempty"`
+}
+
+// matches reports whether the rule recognizes port.
+func (r Rule) matches(port *enumerator.PortDetails) bool {
+	if r.VID == "" && r.SerialNumber == "" {
+		return false
+	}
+	return (r.VID == "" || strings.EqualFold(r.VID, port.VID)) &&
+		(r.PID == "" || strings.EqualFold(r.PID, port.PID)) &&
+		(r.SerialNumber == "" || r.SerialNumber == port.SerialNumber)
+}
+
+// KnownDevices are the built-in rules. Radios with a native USB port are listed by board; radios behind
+// a USB to UART bridge can only be recognized by the bridge chip, which other devices may use as well.
+var KnownDevices = []Rule{
+	// nRF52840 radios with the Adafruit UF2 bootloader
+	{VID: "239A", PID: "8029", Board: "RAK4631", Chip: "nRF52840"},
+	{VID: "239A", PID: "0029", Board: "nRF52840 board (RAK4631, T-Echo)", Chip: "nRF52840"},
+	{VID: "239A", Board: "nRF52840 board", Chip: "nRF52840"},
+	// Nordic development kits expose the radio through the on-board SEGGER J-Link
+	{VID: "1366", Board: "Nordic nRF52 DK (J-Link OB)", Chip: "nRF52"},
+	// ESP32-S3 native USB, such as the T-Deck, Station G2 and XIAO ESP32S3
+	{VID: "303A", PID: "1001", Board: "ESP32-S3 board (native USB)", Chip: "ESP32-S3"},
+	{VID: "303A", Board: "ESP32 board (native USB)", Chip: "ESP32"},
+	// RP2040 radios, such as the RAK11310 and Pico with a LoRa module
+	{VID: "2E8A", PID: "000A", Board: "RP2040 board", Chip: "RP2040"},
+	// USB to UART bridges of ESP32 radios
+	// CP210x is common on Heltec boards, CH9102 on T-Beams, CH340 on T-LoRa and RAK11200
+	{VID: "10C4", PID: "EA60", Board: "ESP32 board (CP210x bridge)", Chip: "CP210x"},
+	{VID: "1A86", PID: "55D4", Board: "ESP32 board (CH9102 bridge)", Chip: "CH9102"},
+	{VID: "1A86", PID: "7523", Board: "ESP32 board (CH340 bridge)", Chip: "CH340"},
+	{VID: "1A86", PID: "5523", Board: "ESP32 board (CH341 bridge)", Chip: "CH341"},
+}
+
+// Port is a serial port recognized as a radio.
+type Port struct {
+	// Name is the path of the port, such as /dev/ttyUSB0 or COM3.
+	Name         string
+	Product      string
+	SerialNumber string
+	VID          string
+	PID          string
+	// Match is the rule that recognized the port.
+	Match Rule
+}
+
+// GetPorts returns the USB serial ports recognized as a radio by rules or by KnownDevices.
+// The given rules are tried first, so they can also name boards the built-in table only knows by chip.
+func GetPorts(rules ...Rule) ([]Port, error) {
+	return listPorts(systemPorts{}, rules)
+}
+
+// portEnumerator lists the serial ports. Watcher uses it through this interface so tests can fake the ports.
+type portEnumerator interface {
+	GetDetailedPortsList() ([]*enumerator.PortDetails, error)
 }
 
-var knownDevices = []usbDevice{
-	// rak4631_19003
-	{VID: "239A", PID: "8029"},
-	// CP210x UART Bridge
-	// Commonly found on Heltec and other devices.
-	{VID: "10C4", PID: "EA60"},
+// systemPorts lists the serial ports of the operating system.
+type systemPorts struct{}
+
+// GetDetailedPortsList implements portEnumerator.
+func (systemPorts) GetDetailedPortsList() ([]*enumerator.PortDetails, error) {
+	return enumerator.GetDetailedPortsList()
 }
 
-// GetPorts returns a list of available serial ports.
-func GetPorts() []string {
-	ports, err := enumerator.GetDetailedPortsList()
+// listPorts returns the ports listed by enum which are recognized as a radio by rules or by KnownDevices.
+func listPorts(enum portEnumerator, rules []Rule) ([]Port, error) {
+	ports, err := enum.GetDetailedPortsList()
 	if err != nil {
-		log.Fatal(err)
-	}
-	var foundDevices []string
-	if len(ports) == 0 {
-		fmt.Println("No serial ports found!")
-		return nil
+		return nil, fmt.Errorf("listing serial ports: %w", err)
 	}
+	rules = append(append([]Rule(nil), rules...), KnownDevices...)
+	var found []Port
 	for _, port := range ports {
-		// fmt.Printf("Found port: %s %s\n", port.PID, port.VID)
-		if port.IsUSB {
-			for _, device := range knownDevices {
-				if device.VID != port.VID {
-					continue
-				}
-				if device.PID != port.PID {
-					continue
-				}
-				foundDevices = append(foundDevices, port.Name)
+		if !port.IsUSB {
+			continue
+		}
+		for _, rule := range rules {
+			if !rule.matches(port) {
+				continue
 			}
+			found = append(found, Port{
+				Name:         port.Name,
+				Product:      port.Product,
+				SerialNumber: port.SerialNumber,
+				VID:          port.VID,
+				PID:          port.PID,
+				Match:        rule,
+			})
+			break
+		}
+	}
+	return found, nil
+}
+
+// LoadRules reads rules from a JSON file holding an array of rules, such as
+//
+//	[{"vid": "1a86", "pid": "55d4", "board": "T-Beam", "chip": "CH9102"},
+//	 {"serial_number": "E6614C311B7B5D2B", "board": "roof node"}]
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading USB rules: %w", err)
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing USB rules %s: %w", path, err)
+	}
+	for i, rule := range rules {
+		if rule.VID == "" && rule.SerialNumber == "" {
+			return nil, fmt.Errorf("USB rule %d in %s: %w", i+1, path, errNoCriteria)
 		}
 	}
-	return foundDevices
+	return rules, nil
 }
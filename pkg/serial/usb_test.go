@@ -0,0 +1,144 @@
+package serial
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.bug.st/serial/enumerator"
+)
+
+func TestRuleMatches(t *testing.T) {
+	port := &enumerator.PortDetails{
+		Name: "/dev/ttyACM0", IsUSB: true, VID: "239a", PID: "8029",
+		SerialNumber: "E6614C311B7B5D2B", Product: "WisCore RAK4631 Board",
+	}
+	tests := []struct {
+		name string
+		rule Rule
+		want bool
+	}{
+		{name: "VID", rule: Rule{VID: "239A"}, want: true},
+		{name: "VID and PID", rule: Rule{VID: "239A", PID: "8029"}, want: true},
+		{name: "PID ignoring case", rule: Rule{VID: "239a", PID: "8029"}, want: true},
+		{name: "other VID", rule: Rule{VID: "10C4"}},
+		{name: "other PID", rule: Rule{VID: "239A", PID: "0029"}},
+		{name: "serial number", rule: Rule{SerialNumber: "E6614C311B7B5D2B"}, want: true},
+		{name: "serial number is case sensitive", rule: Rule{SerialNumber: "e6614c311b7b5d2b"}},
+		{name: "serial number and VID", rule: Rule{VID: "239A", SerialNumber: "E6614C311B7B5D2B"}, want: true},
+		{name: "other serial number", rule: Rule{VID: "239A", SerialNumber: "0000"}},
+		{name: "PID alone", rule: Rule{PID: "8029"}},
+		{name: "board alone", rule: Rule{Board: "RAK4631"}},
+		{name: "empty rule", rule: Rule{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(port); got != tt.want {
+				t.Errorf("%+v matches = %v, want %v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListPorts(t *testing.T) {
+	rak := &enumerator.PortDetails{
+		Name: "/dev/ttyACM0", IsUSB: true, VID: "239A", PID: "8029",
+		SerialNumber: "E6614C311B7B5D2B", Product: "WisCore RAK4631 Board",
+	}
+	tests := []struct {
+		name  string
+		ports []*enumerator.PortDetails
+		rules []Rule
+		want  []Port
+	}{
+		{
+			name:  "known device",
+			ports: []*enumerator.PortDetails{rak},
+			want: []Port{{
+				Name: "/dev/ttyACM0", Product: "WisCore RAK4631 Board", SerialNumber: "E6614C311B7B5D2B",
+				VID: "239A", PID: "8029", Match: KnownDevices[0],
+			}},
+		},
+		{
+			name:  "user rule first",
+			ports: []*enumerator.PortDetails{rak},
+			rules: []Rule{{SerialNumber: "E6614C311B7B5D2B", Board: "roof node"}},
+			want: []Port{{
+				Name: "/dev/ttyACM0", Product: "WisCore RAK4631 Board", SerialNumber: "E6614C311B7B5D2B",
+				VID: "239A", PID: "8029", Match: Rule{SerialNumber: "E6614C311B7B5D2B", Board: "roof node"},
+			}},
+		},
+		{
+			name: "unknown and non-USB ports",
+			ports: []*enumerator.PortDetails{
+				{Name: "/dev/ttyUSB0", IsUSB: true, VID: "0403", PID: "6001"},
+				{Name: "/dev/ttyS0"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listPorts(&fakePorts{ports: tt.ports}, tt.rules)
+			if err != nil {
+				t.Fatalf("listPorts: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("listPorts = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name string
+		// data is written to the rules file; nil leaves it missing.
+		data    []byte
+		want    []Rule
+		wantErr error
+	}{
+		{
+			name: "rules",
+			data: []byte(`[{"vid": "1a86", "pid": "55d4", "board": "T-Beam", "chip": "CH9102"},
+				{"serial_number": "E6614C311B7B5D2B", "board": "roof node"}]`),
+			want: []Rule{
+				{VID: "1a86", PID: "55d4", Board: "T-Beam", Chip: "CH9102"},
+				{SerialNumber: "E6614C311B7B5D2B", Board: "roof node"},
+			},
+		},
+		{name: "empty array", data: []byte(`[]`), want: []Rule{}},
+		{name: "malformed JSON", data: []byte(`[{"vid": "1a86",`)},
+		{name: "object instead of array", data: []byte(`{"vid": "1a86"}`)},
+		{name: "wrong field type", data: []byte(`[{"vid": 6790}]`)},
+		{name: "rule without criteria", data: []byte(`[{"vid": "1a86"}, {"board": "anything"}]`), wantErr: errNoCriteria},
+		{name: "missing file", wantErr: os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			if tt.data != nil {
+				if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := LoadRules(path)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("LoadRules = %+v, want an error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("LoadRules error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadRules: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("LoadRules = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package serial
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often a Watcher lists the serial ports.
+const DefaultWatchInterval = 2 * time.Second
+
+// ChangeKind tells whether a radio appeared or went away.
+type ChangeKind int
+
+const (
+	// Attached is reported for a radio that appeared, including those present when watching starts.
+	Attached ChangeKind = iota + 1
+	// Detached is reported for a radio that went away or moved to a different port.
+	Detached
+)
+
+// String returns the name of the kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case Attached:
+		return "attached"
+	case Detached:
+		return "detached"
+	default:
+		return "unknown"
+	}
+}
+
+// Change is a radio appearing or going away.
+type Change struct {
+	Kind ChangeKind
+	Port Port
+}
+
+// Key identifies the device behind the port across re-enumeration: the USB serial number when the device
+// reports one, otherwise VID, PID and port name, which only stay the same as long as the path does.
+// Many USB to UART bridges, such as the CH340, report no serial number, see Stable.
+func (p Port) Key() string {
+	if p.SerialNumber != "" {
+		return p.SerialNumber
+	}
+	return p.VID + ":" + p.PID + "@" + p.Name
+}
+
+// Stable reports whether Key follows the device to another path. A device without a USB serial number
+// that comes back on another path gets another key, and is reported as a new radio.
+func (p Port) Stable() bool {
+	return p.SerialNumber != ""
+}
+
+// Watcher polls the serial ports and reports radios appearing and going away, keyed by Port.Key so a
+// radio which comes back on a different path, or in its bootloader after a flash, is recognized as long
+// as it reports a USB serial number. Polling works the same on every platform and needs no udev access.
+type Watcher struct {
+	// Interval is how often the ports are listed.
+	Interval time.Duration
+	// Rules are tried before KnownDevices to recognize a radio, see GetPorts.
+	Rules []Rule
+
+	// enum lists the ports, the ports of the operating system when nil.
+	enum portEnumerator
+
+	mu    sync.Mutex
+	ports map[string]Port
+}
+
+// NewWatcher creates a Watcher recognizing radios with rules and KnownDevices.
+func NewWatcher(rules ...Rule) *Watcher {
+	return &Watcher{Interval: DefaultWatchInterval, Rules: rules}
+}
+
+// Watch polls the ports until ctx is done and sends every change on the returned channel, which is
+// closed when watching stops. A listing that fails is retried at the next interval.
+func (w *Watcher) Watch(ctx context.Context) <-chan Change {
+	changes := make(chan Change)
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(w.Interval)
+		defer ticker.Stop()
+		for {
+			for _, change := range w.poll() {
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return changes
+}
+
+// poll lists the ports and returns the changes since the last listing.
+func (w *Watcher) poll() []Change {
+	enum := w.enum
+	if enum == nil {
+		enum = systemPorts{}
+	}
+	ports, err := listPorts(enum, w.Rules)
+	if err != nil {
+		return nil
+	}
+	current := make(map[string]Port, len(ports))
+	for _, port := range ports {
+		current[port.Key()] = port
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var changes []Change
+	for key, old := range w.ports {
+		if port, ok := current[key]; !ok || port != old {
+			changes = append(changes, Change{Kind: Detached, Port: old})
+		}
+	}
+	for key, port := range current {
+		if old, ok := w.ports[key]; !ok || port != old {
+			changes = append(changes, Change{Kind: Attached, Port: port})
+		}
+	}
+	w.ports = current
+	// Detaches go first, so a radio that moved is reported gone before it is reported back.
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind > changes[j].Kind
+		}
+		return changes[i].Port.Name < changes[j].Port.Name
+	})
+	return changes
+}
+
+// Ports returns the radios present at the last listing.
+func (w *Watcher) Ports() []Port {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ports := make([]Port, 0, len(w.ports))
+	for _, port := range w.ports {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Name < ports[j].Name })
+	return ports
+}
+
+// Lookup returns the radio with key as of the last listing.
+func (w *Watcher) Lookup(key string) (Port, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	port, ok := w.ports[key]
+	return port, ok
+}
+
+// FindPort lists the ports and returns the radio with key, wherever it is attached now.
+func FindPort(key string, rules ...Rule) (Port, bool, error) {
+	ports, err := GetPorts(rules...)
+	if err != nil {
+		return Port{}, false, err
+	}
+	for _, port := range ports {
+		if port.Key() == key {
+			return port, true, nil
+		}
+	}
+	return Port{}, false, nil
+}
@@ -0,0 +1,111 @@
+package serial
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"go.bug.st/serial/enumerator"
+)
+
+// fakePorts is a portEnumerator listing ports set by the test.
+type fakePorts struct {
+	ports []*enumerator.PortDetails
+	err   error
+}
+
+func (f *fakePorts) GetDetailedPortsList() ([]*enumerator.PortDetails, error) {
+	return f.ports, f.err
+}
+
+// usbPort returns a USB port with a CP210x bridge, which KnownDevices recognizes.
+func usbPort(name, serialNumber string) *enumerator.PortDetails {
+	return &enumerator.PortDetails{Name: name, IsUSB: true, VID: "10C4", PID: "EA60", SerialNumber: serialNumber}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	tests := []struct {
+		name string
+		// before is listed by the first poll, after by the second.
+		before, after []*enumerator.PortDetails
+		err           error
+		// want are the changes of the second poll as kind and port name.
+		want []string
+	}{
+		{
+			name:  "attached",
+			after: []*enumerator.PortDetails{usbPort("/dev/ttyUSB1", ""), usbPort("/dev/ttyUSB0", "A1")},
+			want:  []string{"attached /dev/ttyUSB0", "attached /dev/ttyUSB1"},
+		},
+		{
+			name:   "detached",
+			before: []*enumerator.PortDetails{usbPort("/dev/ttyUSB0", "A1")},
+			want:   []string{"detached /dev/ttyUSB0"},
+		},
+		{
+			name:   "unchanged",
+			before: []*enumerator.PortDetails{usbPort("/dev/ttyUSB0", "A1"), usbPort("/dev/ttyUSB1", "")},
+			after:  []*enumerator.PortDetails{usbPort("/dev/ttyUSB0", "A1"), usbPort("/dev/ttyUSB1", "")},
+		},
+		{
+			name:   "moved with serial number",
+			before: []*enumerator.PortDetails{usbPort("/dev/ttyUSB0", "A1")},
+			after:  []*enumerator.PortDetails{usbPort("/dev/ttyUSB1", "A1")},
+			want:   []string{"detached /dev/ttyUSB0", "attached /dev/ttyUSB1"},
+		},
+		{
+			name:   "moved without serial number",
+			before: []*enumerator.PortDetails{usbPort("/dev/ttyUSB0", "")},
+			after:  []*enumerator.PortDetails{usbPort("/dev/ttyUSB1", "")},
+			want:   []string{"detached /dev/ttyUSB0", "attached /dev/ttyUSB1"},
+		},
+		{
+			name:   "not a radio",
+			before: []*enumerator.PortDetails{{Name: "/dev/ttyS0"}},
+			after:  []*enumerator.PortDetails{{Name: "/dev/ttyS0"}, {Name: "/dev/ttyACM0", IsUSB: true, VID: "0403", PID: "6001"}},
+		},
+		{
+			name:   "listing failed",
+			before: []*enumerator.PortDetails{usbPort("/dev/ttyUSB0", "A1")},
+			err:    errors.New("no sysfs"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enum := &fakePorts{ports: tt.before}
+			w := &Watcher{enum: enum}
+			w.poll()
+			enum.ports, enum.err = tt.after, tt.err
+
+			var got []string
+			for _, change := range w.poll() {
+				got = append(got, change.Kind.String()+" "+change.Port.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		port       Port
+		wantKey    string
+		wantStable bool
+	}{
+		{name: "serial number", port: Port{Name: "/dev/ttyACM0", VID: "239A", PID: "8029", SerialNumber: "F00D"}, wantKey: "F00D", wantStable: true},
+		{name: "no serial number", port: Port{Name: "/dev/ttyUSB0", VID: "1A86", PID: "7523"}, wantKey: "1A86:7523@/dev/ttyUSB0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.port.Key(); got != tt.wantKey {
+				t.Errorf("Key = %q, want %q", got, tt.wantKey)
+			}
+			if got := tt.port.Stable(); got != tt.wantStable {
+				t.Errorf("Stable = %v, want %v", got, tt.wantStable)
+			}
+		})
+	}
+}